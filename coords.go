@@ -0,0 +1,260 @@
+package kikashi
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// -------------------------------------------------------------------------
+// Alternative coordinate systems. Internally everything is still zeroth
+// indexed from the top left; these just convert to and from text.
+
+type CoordSystem int
+
+const (
+	COORD_SGF = CoordSystem(iota)		// "dp"
+	COORD_GTP							// "D4"
+	COORD_NUMERIC						// "4-4"
+	COORD_JAPANESE						// "四の四"
+	COORD_CHINESE						// "四之四"
+)
+
+type Origin int
+
+const (
+	TOP_LEFT = Origin(iota)
+	TOP_RIGHT
+	BOTTOM_LEFT
+	BOTTOM_RIGHT
+)
+
+type CoordFormat struct {
+	System			CoordSystem
+	Origin			Origin			// Only used by the numeric systems. SGF and GTP have fixed origins.
+}
+
+var KANJI_DIGITS = []string{"", "一", "二", "三", "四", "五", "六", "七", "八", "九"}
+
+const KANJI_TEN = "十"
+
+
+func (self Origin) transform(x, y, size int) (int, int) {
+
+	// Converts between board coordinates and coordinates relative to the origin.
+	// The transformation is its own inverse, so this works in both directions.
+
+	switch self {
+	case TOP_RIGHT:
+		return size - 1 - x, y
+	case BOTTOM_LEFT:
+		return x, size - 1 - y
+	case BOTTOM_RIGHT:
+		return size - 1 - x, size - 1 - y
+	default:
+		return x, y
+	}
+}
+
+
+func (self CoordFormat) StringFromPoint(x, y, size int) string {
+
+	// Returns "" if the point can't be expressed in this system.
+
+	if x < 0 || x >= size || y < 0 || y >= size {
+		return ""
+	}
+
+	switch self.System {
+
+	case COORD_SGF:
+		return SGFStringFromPoint(x, y)
+
+	case COORD_GTP:
+		if size > 25 {
+			return ""
+		}
+		return HumanStringFromPoint(x, y, size)
+	}
+
+	col, row := self.Origin.transform(x, y, size)
+
+	switch self.System {
+
+	case COORD_NUMERIC:
+		return fmt.Sprintf("%d-%d", col + 1, row + 1)
+
+	case COORD_JAPANESE:
+		return kanji_from_int(col + 1) + "の" + kanji_from_int(row + 1)
+
+	case COORD_CHINESE:
+		return kanji_from_int(col + 1) + "之" + kanji_from_int(row + 1)
+	}
+
+	return ""
+}
+
+
+func (self CoordFormat) PointFromString(s string, size int) (x int, y int, ok bool) {
+
+	s = strings.TrimSpace(s)
+
+	switch self.System {
+
+	case COORD_SGF:
+		if len(s) != 2 {
+			return 0, 0, false
+		}
+		return PointFromSGFString(s, size)
+
+	case COORD_GTP:
+		s = strings.ToUpper(s)
+		if size > 25 || len(s) < 2 || s[0] == 'I' {
+			return 0, 0, false
+		}
+		x, y, ok = PointFromHumanString(s, size)
+		if ok == false || x < 0 || x >= size || y < 0 || y >= size {
+			return 0, 0, false
+		}
+		return x, y, true
+
+	case COORD_NUMERIC, COORD_JAPANESE, COORD_CHINESE:
+		col, row, ok := parse_numeric_pair(s)
+		if ok == false || col < 1 || col > size || row < 1 || row > size {
+			return 0, 0, false
+		}
+		x, y = self.Origin.transform(col - 1, row - 1, size)
+		return x, y, true
+	}
+
+	return 0, 0, false
+}
+
+
+func PointFromAnyString(s string, size int, origin Origin) (x int, y int, ok bool) {
+
+	// Tries each system in turn, for when we don't know what the user typed.
+	// The systems are distinguishable: SGF is 2 letters, GTP is a letter then
+	// digits, and the numeric systems need a separator.
+
+	for _, system := range []CoordSystem{COORD_SGF, COORD_GTP, COORD_NUMERIC} {
+
+		f := CoordFormat{System: system, Origin: origin}
+
+		x, y, ok = f.PointFromString(s, size)
+		if ok {
+			return x, y, true
+		}
+	}
+
+	return 0, 0, false
+}
+
+
+func parse_numeric_pair(s string) (int, int, bool) {
+
+	// Accepts "4-4", "4,4", "4 4", "四の四", "十七之四", "17の4", full-width digits, etc.
+
+	s = strings.Map(func(r rune) rune {
+		if r >= '０' && r <= '９' {
+			return '0' + (r - '０')
+		}
+		return r
+	}, s)
+
+	for _, sep := range []string{"-", ",", " ", "の", "之", "・", "·", "－", "，"} {
+
+		parts := strings.SplitN(s, sep, 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		a, ok_a := int_from_numeral(strings.TrimSpace(parts[0]))
+		b, ok_b := int_from_numeral(strings.TrimSpace(parts[1]))
+
+		if ok_a && ok_b {
+			return a, b, true
+		}
+	}
+
+	return 0, 0, false
+}
+
+
+func int_from_numeral(s string) (int, bool) {
+
+	// Arabic or kanji numerals, up to 99.
+
+	if s == "" {
+		return 0, false
+	}
+
+	if val, err := strconv.Atoi(s); err == nil {
+		return val, true
+	}
+
+	var tens, units int
+	var seen_ten bool
+	var pending int
+
+	for _, r := range s {
+
+		c := string(r)
+
+		if c == KANJI_TEN {
+			if seen_ten {
+				return 0, false
+			}
+			seen_ten = true
+			if pending == 0 {
+				pending = 1
+			}
+			tens = pending
+			pending = 0
+			continue
+		}
+
+		digit := 0
+		for i := 1; i < len(KANJI_DIGITS); i++ {
+			if KANJI_DIGITS[i] == c {
+				digit = i
+				break
+			}
+		}
+
+		if digit == 0 || pending != 0 {
+			return 0, false
+		}
+
+		pending = digit
+	}
+
+	units = pending
+
+	return tens * 10 + units, true
+}
+
+
+func kanji_from_int(n int) string {
+
+	// Only meaningful for 1 to 99.
+
+	if n <= 0 || n >= 100 {
+		return ""
+	}
+
+	var s string
+
+	tens := n / 10
+	units := n % 10
+
+	if tens > 1 {
+		s += KANJI_DIGITS[tens]
+	}
+	if tens > 0 {
+		s += KANJI_TEN
+	}
+
+	s += KANJI_DIGITS[units]
+	return s
+}
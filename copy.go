@@ -0,0 +1,176 @@
+package kikashi
+
+import (
+	"fmt"
+)
+
+// -------------------------------------------------------------------------
+// Copying, and turning part of a tree into a game of its own.
+
+
+func (self *Node) Copy() *Node {
+
+	// Deep copy of this node and everything below it, boards included.
+	// The copy has no parent, so copying a non-root node gives a detached
+	// subtree, suitable for Paste().
+
+	return self.copy_under(nil)
+}
+
+
+func (self *Node) copy_under(parent *Node) *Node {
+
+	// Copy this node and its descendants, attaching the copy to parent (which may be nil).
+
+	copies := make(map[*Node]*Node)
+
+	self.WalkDepthFirst(func(node *Node, depth int) WalkAction {
+
+		new_parent := parent
+		if depth > 0 {
+			new_parent = copies[node.Parent]
+		}
+
+		c := new_bare_node(new_parent)
+		c.Props = copy_props(node.Props)
+		c.key_order = append([]string(nil), node.key_order...)
+		c.layout = node.layout					// Never modified, so can be shared.
+		c.Board = copy_board(node.Board)
+		c.SZ_cache = node.SZ_cache
+
+		copies[node] = c
+		return WALK_CONTINUE
+
+	}, func(node *Node, depth int) WalkAction {
+
+		if node.last_visited != nil {
+			copies[node].last_visited = copies[node.last_visited]
+		}
+		return WALK_CONTINUE
+	})
+
+	return copies[self]
+}
+
+
+func (self *Node) ExtractSubtree() *Node {
+
+	// A new game whose root reproduces this node's position via AB / AW,
+	// with copies of all the variations below this node.
+
+	root := self.position_root()
+
+	for _, child := range self.Children {
+		c := child.copy_under(root)
+		if child == self.last_visited {
+			root.last_visited = c
+		}
+	}
+
+	return root
+}
+
+
+func (self *Node) ExtractLine() *Node {
+
+	// As ExtractSubtree(), but only the main line (following Children[0]) is kept.
+
+	root := self.position_root()
+
+	src := self
+	dst := root
+
+	for len(src.Children) > 0 {
+		src = src.Children[0]
+		node := new_bare_node(dst)
+		node.Props = copy_props(src.Props)
+		node.key_order = append([]string(nil), src.key_order...)
+		node.Board = copy_board(src.Board)
+		node.SZ_cache = src.SZ_cache
+		dst = node
+	}
+
+	return root
+}
+
+
+func (self *Node) position_root() *Node {
+
+	// Make a parentless node whose setup stones give the same board as this
+	// node. Game info from the original root, and this node's own non-board
+	// properties (comments, markup...), are carried over. Note that props are
+	// copied in their stored (escaped) form, so we bypass add_value().
+
+	sz := self.Size()
+	old_root := self.GetRoot()
+
+	node := new_bare_node(nil)
+
+	for key, values := range old_root.Props {
+		if is_mutor(key) == false {
+			node.Props[key] = append([]string(nil), values...)
+		}
+	}
+
+	if self != old_root {
+		for key, values := range self.Props {
+			if is_mutor(key) == false && key != "PL" {
+				node.Props[key] = append([]string(nil), values...)
+			}
+		}
+	}
+
+	for x := 0; x < sz; x++ {
+		for y := 0; y < sz; y++ {
+			if self.Board[x][y] == BLACK {
+				node.Props["AB"] = append(node.Props["AB"], SGFStringFromPoint(x, y))
+			} else if self.Board[x][y] == WHITE {
+				node.Props["AW"] = append(node.Props["AW"], SGFStringFromPoint(x, y))
+			}
+		}
+	}
+
+	node.Props["SZ"] = []string{fmt.Sprintf("%d", sz)}
+	node.Props["PL"] = []string{COLMAP[self.NextColour()]}
+
+	node.make_board()
+	return node
+}
+
+
+func is_mutor(key string) bool {
+	for _, s := range MUTORS {
+		if key == s {
+			return true
+		}
+	}
+	return false
+}
+
+
+func copy_props(props map[string][]string) map[string][]string {
+
+	ret := make(map[string][]string)
+
+	for key, values := range props {
+		ret[key] = append([]string(nil), values...)
+	}
+
+	return ret
+}
+
+
+func copy_board(board [][]Colour) [][]Colour {
+
+	if board == nil {
+		return nil
+	}
+
+	ret := make([][]Colour, len(board))
+
+	for x := 0; x < len(board); x++ {
+		ret[x] = append([]Colour(nil), board[x]...)
+	}
+
+	return ret
+}
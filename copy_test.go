@@ -0,0 +1,34 @@
+package kikashi
+
+import (
+	"testing"
+)
+
+func TestExtractWhiteToMove(t *testing.T) {
+
+	// After B, W, B it is White's turn. The extracted root has both AB and AW,
+	// so only its PL says so.
+
+	root, err := load_sgf("(;GM[1]FF[4]SZ[19];B[dd];W[pp];B[dp])", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root.make_board_recursive()
+
+	node := root.Children[0].Children[0].Children[0]
+
+	for _, extracted := range []*Node{node.ExtractSubtree(), node.ExtractLine()} {
+
+		if len(extracted.Props["AB"]) != 2 || len(extracted.Props["AW"]) != 1 {
+			t.Errorf("extracted root has AB %v, AW %v", extracted.Props["AB"], extracted.Props["AW"])
+		}
+
+		if extracted.NextColour() != WHITE {
+			t.Errorf("extracted root gave NextColour() %v, want WHITE", extracted.NextColour())
+		}
+
+		if extracted.SameBoard(node) == false {
+			t.Errorf("extracted root has a different board")
+		}
+	}
+}
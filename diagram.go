@@ -0,0 +1,365 @@
+package kikashi
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// -------------------------------------------------------------------------
+// Text diagrams of a position. The plain style uses the conventions of
+// Sensei's Library:
+//
+//		X O			black, white stones
+//		. ,			empty point, star point
+//		B W C		circled black, white, empty (CR)
+//		# @ S		squared (SQ)
+//		Y Q T		triangled (TR)
+//		Z P M		marked with a cross (MA)
+//		a-z 0-9		labels (LB), lowercased; "?" for other labels
+//
+// The Unicode style uses a box-drawing grid and the symbols in UNICODE_GLYPHS.
+// In both, the last move is bracketed, e.g. "X(O)X". Labels on stones, and
+// any markup other than the first of CR / SQ / TR / MA, are not shown.
+//
+// ParseDiagram() reads either style back.
+
+type DiagramOptions struct {
+	Unicode			bool			// Box-drawing grid and stone symbols, rather than plain ASCII.
+	Captures		bool			// Add a line with the number of stones each side has captured.
+}
+
+type diagram_glyphs struct {
+	black			[]rune			// Plain, then as DIAGRAM_MARKUP_KEYS.
+	white			[]rune
+	empty			[]rune			// The first entry is unused in the Unicode style (the grid is drawn instead).
+	star			rune
+}
+
+var DIAGRAM_MARKUP_KEYS = []string{"CR", "SQ", "TR", "MA"}
+
+var ASCII_GLYPHS = diagram_glyphs{
+	black: []rune("XB#YZ"),
+	white: []rune("OW@QP"),
+	empty: []rune(".CSTM"),
+	star: ',',
+}
+
+var UNICODE_GLYPHS = diagram_glyphs{
+	black: []rune("●◉■▲◆"),
+	white: []rune("○◎□△◇"),
+	empty: []rune("┼◯▫▵×"),
+	star: '╋',
+}
+
+const GRID_RUNES = "┌┬┐├┼┤└┴┘╋─"
+
+var diagram_row_regexp = regexp.MustCompile(`^\s*[0-9]+([ (].*)$`)
+
+
+func (self *Node) Diagram() string {
+	return self.DrawDiagram(DiagramOptions{})
+}
+
+
+func (self *Node) DrawDiagram(opts DiagramOptions) string {
+
+	if self.Board == nil {					// e.g. read by an SGFReader with SkipBoards.
+		self.MakeBoards()
+	}
+
+	sz := self.Size()
+
+	glyphs := ASCII_GLYPHS
+	if opts.Unicode {
+		glyphs = UNICODE_GLYPHS
+	}
+
+	// Which markup (index into DIAGRAM_MARKUP_KEYS, plus 1) and label is on each point...
+
+	markup := make(map[Point]int)
+	labels := make(map[Point]rune)
+
+	for i := len(DIAGRAM_MARKUP_KEYS) - 1; i >= 0; i-- {		// Reversed, so the first key wins.
+		for _, p := range self.MarkupPoints(DIAGRAM_MARKUP_KEYS[i]) {
+			markup[p] = i + 1
+		}
+	}
+
+	for _, label := range self.Labels() {
+		labels[label.Point] = label_rune(label.Text)
+	}
+
+	stars := make(map[Point]bool)
+
+	for _, p := range star_points(sz) {
+		stars[p] = true
+	}
+
+	last := Point{-1, -1}
+	if mv := self.MoveInfo(); mv.OK && mv.Pass == false {
+		last = Point{mv.X, mv.Y}
+	}
+
+	letters := "ABCDEFGHJKLMNOPQRSTUVWXYZ"
+	if sz > len(letters) {
+		letters = ALPHA
+	}
+
+	margin := len(fmt.Sprintf("%d", sz))
+
+	var lines []string
+
+	header := strings.Repeat(" ", margin)
+	for x := 0; x < sz; x++ {
+		header += " " + letters[x:x + 1]
+	}
+	lines = append(lines, header)
+
+	for y := 0; y < sz; y++ {
+
+		var b strings.Builder
+		fmt.Fprintf(&b, "%*d", margin, sz - y)
+
+		for x := 0; x <= sz; x++ {
+
+			// The gap before point x (or after the last point)...
+
+			if last.Y == y && last.X == x {
+				b.WriteRune('(')
+			} else if last.Y == y && last.X == x - 1 {
+				b.WriteRune(')')
+			} else if opts.Unicode && x > 0 && x < sz {
+				b.WriteRune('─')
+			} else {
+				b.WriteRune(' ')
+			}
+
+			if x == sz {
+				break
+			}
+
+			// The point itself...
+
+			p := Point{x, y}
+
+			switch self.Board[x][y] {
+			case BLACK:
+				b.WriteRune(glyphs.black[markup[p]])
+			case WHITE:
+				b.WriteRune(glyphs.white[markup[p]])
+			default:
+				if markup[p] > 0 {
+					b.WriteRune(glyphs.empty[markup[p]])
+				} else if r, ok := labels[p]; ok {
+					b.WriteRune(r)
+				} else if stars[p] {
+					b.WriteRune(glyphs.star)
+				} else if opts.Unicode {
+					b.WriteRune(grid_rune(x, y, sz))
+				} else {
+					b.WriteRune(glyphs.empty[0])
+				}
+			}
+		}
+
+		lines = append(lines, strings.TrimRight(b.String(), " "))
+	}
+
+	if opts.Captures {
+		by_black, by_white := self.Captures()
+		lines = append(lines, fmt.Sprintf("Captures: B %d, W %d", by_black, by_white))
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+
+func (self *Node) Captures() (by_black int, by_white int) {
+
+	// Stones captured by each side in the moves leading to this node,
+	// worked out from the boards.
+
+	for node := self; node.Parent != nil; node = node.Parent {
+
+		mv := node.MoveInfo()
+		if mv.OK == false || mv.Pass {
+			continue
+		}
+
+		n := 0
+		opponent := mv.Colour.Opposite()
+
+		for x := 0; x < len(node.Board); x++ {
+			for y := 0; y < len(node.Board[x]); y++ {
+				if node.Parent.Board[x][y] == opponent && node.Board[x][y] == EMPTY {
+					n++
+				}
+			}
+		}
+
+		if mv.Colour == BLACK {
+			by_black += n
+		} else {
+			by_white += n
+		}
+	}
+
+	return by_black, by_white
+}
+
+
+func ParseDiagram(s string) (*Node, error) {
+
+	// Read a diagram in either style. Returns a new root with the stones as
+	// AB / AW, and the markup. If a last move is marked, it is played in a
+	// child of the root instead, the markup goes there, and the child is
+	// returned. Lines that aren't board rows (e.g. headers) are ignored.
+
+	type cell struct {
+		colour			Colour
+		key				string
+		label			rune
+	}
+
+	lookup := make(map[rune]cell)
+
+	for _, g := range []diagram_glyphs{ASCII_GLYPHS, UNICODE_GLYPHS} {
+		for i, key := range append([]string{""}, DIAGRAM_MARKUP_KEYS...) {
+			lookup[g.black[i]] = cell{colour: BLACK, key: key}
+			lookup[g.white[i]] = cell{colour: WHITE, key: key}
+			lookup[g.empty[i]] = cell{colour: EMPTY, key: key}
+		}
+		lookup[g.star] = cell{}
+	}
+
+	for _, r := range GRID_RUNES {
+		lookup[r] = cell{}
+	}
+
+	var rows [][]cell
+	last := Point{-1, -1}
+
+	for _, line := range strings.Split(s, "\n") {
+
+		m := diagram_row_regexp.FindStringSubmatch(strings.TrimRight(line, " \r"))
+		if m == nil {
+			continue
+		}
+
+		var row []cell
+
+		for _, r := range m[1] {
+
+			if r == ' ' || r == '─' || r == ')' {
+				continue
+			}
+
+			if r == '(' {
+				last = Point{len(row), len(rows)}
+				continue
+			}
+
+			c, ok := lookup[r]
+
+			if ok == false {
+				if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '?' {
+					c = cell{label: r}
+				} else {
+					return nil, fmt.Errorf("ParseDiagram(): unknown symbol %q", r)
+				}
+			}
+
+			row = append(row, c)
+		}
+
+		rows = append(rows, row)
+	}
+
+	sz := len(rows)
+
+	if sz < 1 || sz > 52 {
+		return nil, fmt.Errorf("ParseDiagram(): found %d rows", sz)
+	}
+
+	setup := map[string][]string{"SZ": []string{fmt.Sprintf("%d", sz)}}
+	props := make(map[string][]string)
+
+	for y, row := range rows {
+
+		if len(row) != sz {
+			return nil, fmt.Errorf("ParseDiagram(): row %d has %d points, expected %d", y + 1, len(row), sz)
+		}
+
+		for x, c := range row {
+
+			p := Point{x, y}
+
+			if c.colour != EMPTY && p == last {
+				props[COLMAP[c.colour]] = []string{p.SGFString()}
+			} else if c.colour == BLACK {
+				setup["AB"] = append(setup["AB"], p.SGFString())
+			} else if c.colour == WHITE {
+				setup["AW"] = append(setup["AW"], p.SGFString())
+			}
+
+			if c.key != "" {
+				props[c.key] = append(props[c.key], p.SGFString())
+			}
+
+			if c.label != 0 {
+				props["LB"] = append(props["LB"], p.SGFString() + ":" + string(c.label))
+			}
+		}
+	}
+
+	if last.X >= 0 && len(props["B"]) + len(props["W"]) == 0 {
+		return nil, fmt.Errorf("ParseDiagram(): last move marker on an empty point")
+	}
+
+	if len(props["B"]) + len(props["W"]) == 0 {
+		for key, values := range props {
+			setup[key] = values
+		}
+		return NewNode(nil, setup), nil
+	}
+
+	root := NewNode(nil, setup)
+	return NewNode(root, props), nil
+}
+
+
+func label_rune(text string) rune {
+
+	// How a label is shown in a diagram: its first character, lowercased, if
+	// it's a letter or digit.
+
+	for _, r := range strings.ToLower(text) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		break
+	}
+
+	return '?'
+}
+
+
+func grid_rune(x, y, size int) rune {
+
+	col := 1
+	if x == 0 {
+		col = 0
+	} else if x == size - 1 {
+		col = 2
+	}
+
+	row := 1
+	if y == 0 {
+		row = 0
+	} else if y == size - 1 {
+		row = 2
+	}
+
+	return []rune("┌┬┐├┼┤└┴┘")[row * 3 + col]
+}
@@ -0,0 +1,35 @@
+package kikashi
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiagramRoundTrip(t *testing.T) {
+
+	// The tree is read without boards, which DrawDiagram() must cope with.
+
+	reader := NewSGFReader(strings.NewReader("(;GM[1]FF[4]SZ[9]AB[cc][gg];W[ee];B[ef];W[ff]TR[ef];B[dd])"))
+	reader.SkipBoards = true
+
+	root, err := reader.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	node := root.GetEnd()
+
+	for _, opts := range []DiagramOptions{{}, {Unicode: true}} {
+
+		diagram := node.DrawDiagram(opts)
+
+		parsed, err := ParseDiagram(diagram)
+		if err != nil {
+			t.Fatalf("ParseDiagram(): %v, diagram:\n%s", err, diagram)
+		}
+
+		if parsed.SameBoard(node) == false {
+			t.Errorf("diagram did not round trip:\n%s", diagram)
+		}
+	}
+}
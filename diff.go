@@ -0,0 +1,334 @@
+package kikashi
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// -------------------------------------------------------------------------
+// Comparing two trees, e.g. a game and a reviewed copy of it. Nodes are
+// matched by the move they play (and any setup stones) so that reordered
+// variations aren't reported as added and removed.
+
+type DiffKind int
+
+const (
+	DIFF_ADDED = DiffKind(iota)			// Variation only in the new tree.
+	DIFF_REMOVED						// Variation only in the old tree.
+	DIFF_CHANGED						// Node in both, with different properties.
+	DIFF_REORDERED						// Node in both, at a different position among its siblings.
+)
+
+type PropChange struct {
+	Key				string
+	Old				[]string		// Unescaped. Nil if the key was absent.
+	New				[]string
+}
+
+type DiffEntry struct {
+	Kind			DiffKind
+	OldPath			[]int			// Nil for DIFF_ADDED.
+	NewPath			[]int			// Nil for DIFF_REMOVED.
+	Move			Move			// The node's move, if any.
+	Nodes			int				// For added / removed variations: how many nodes.
+	Changes			[]PropChange	// For DIFF_CHANGED.
+}
+
+type TreeDiff struct {
+	Entries			[]DiffEntry
+}
+
+
+func Diff(old_tree, new_tree *Node) *TreeDiff {
+
+	// Both arguments are taken from their roots.
+
+	ret := new(TreeDiff)
+
+	type pair struct {
+		old_node	*Node
+		new_node	*Node
+		old_path	[]int
+		new_path	[]int
+	}
+
+	stack := []pair{{old_tree.GetRoot(), new_tree.GetRoot(), []int{}, []int{}}}
+
+	for len(stack) > 0 {
+
+		p := stack[len(stack) - 1]
+		stack = stack[:len(stack) - 1]
+
+		// Only the roots weren't matched by node_identity(), which compares
+		// the board-altering properties; so only they need those compared here.
+
+		changes := diff_props(p.old_node, p.new_node, len(p.old_path) == 0)
+
+		if len(changes) > 0 {
+			ret.Entries = append(ret.Entries, DiffEntry{
+				Kind: DIFF_CHANGED,
+				OldPath: p.old_path,
+				NewPath: p.new_path,
+				Move: p.new_node.MoveInfo(),
+				Changes: changes,
+			})
+		}
+
+		var matched []pair
+		var new_indices []int
+		used := make(map[*Node]bool)
+		match := make([]int, len(p.old_node.Children))		// Index into new children, or -1.
+
+		for i, old_child := range p.old_node.Children {
+
+			key := node_identity(old_child)
+			match[i] = -1
+
+			for j, new_child := range p.new_node.Children {
+				if used[new_child] == false && node_identity(new_child) == key {
+					used[new_child] = true
+					match[i] = j
+					new_indices = append(new_indices, j)
+					break
+				}
+			}
+		}
+
+		// A matched child has moved if its place among the matched children
+		// has changed; added or removed siblings don't count as moving it.
+
+		sort.Ints(new_indices)
+
+		for i, old_child := range p.old_node.Children {
+
+			j := match[i]
+
+			if j == -1 {
+				ret.Entries = append(ret.Entries, DiffEntry{
+					Kind: DIFF_REMOVED,
+					OldPath: append(append([]int(nil), p.old_path...), i),
+					Move: old_child.MoveInfo(),
+					Nodes: count_nodes(old_child),
+				})
+				continue
+			}
+
+			new_child := p.new_node.Children[j]
+
+			old_path := append(append([]int(nil), p.old_path...), i)
+			new_path := append(append([]int(nil), p.new_path...), j)
+
+			if new_indices[len(matched)] != j {
+				ret.Entries = append(ret.Entries, DiffEntry{
+					Kind: DIFF_REORDERED,
+					OldPath: old_path,
+					NewPath: new_path,
+					Move: new_child.MoveInfo(),
+				})
+			}
+
+			matched = append(matched, pair{old_child, new_child, old_path, new_path})
+		}
+
+		for j, new_child := range p.new_node.Children {
+			if used[new_child] == false {
+				ret.Entries = append(ret.Entries, DiffEntry{
+					Kind: DIFF_ADDED,
+					NewPath: append(append([]int(nil), p.new_path...), j),
+					Move: new_child.MoveInfo(),
+					Nodes: count_nodes(new_child),
+				})
+			}
+		}
+
+		// Push in reverse so the first child is dealt with first...
+
+		for i := len(matched) - 1; i >= 0; i-- {
+			stack = append(stack, matched[i])
+		}
+	}
+
+	return ret
+}
+
+
+func (self *TreeDiff) Empty() bool {
+	return len(self.Entries) == 0
+}
+
+
+func (self *TreeDiff) String() string {
+
+	var lines []string
+
+	for _, e := range self.Entries {
+
+		mv := ""
+		if e.Move.OK {
+			mv = " " + e.Move.String()
+		}
+
+		switch e.Kind {
+
+		case DIFF_ADDED:
+			lines = append(lines, fmt.Sprintf("+ %s%s: variation added (%d nodes)", PathString(e.NewPath), mv, e.Nodes))
+
+		case DIFF_REMOVED:
+			lines = append(lines, fmt.Sprintf("- %s%s: variation removed (%d nodes)", PathString(e.OldPath), mv, e.Nodes))
+
+		case DIFF_REORDERED:
+			lines = append(lines, fmt.Sprintf("> %s%s: moved to %s", PathString(e.OldPath), mv, PathString(e.NewPath)))
+
+		case DIFF_CHANGED:
+			lines = append(lines, fmt.Sprintf("~ %s -> %s%s:", PathString(e.OldPath), PathString(e.NewPath), mv))
+			for _, c := range e.Changes {
+				if c.Old == nil {
+					lines = append(lines, fmt.Sprintf("    %s added: %s", c.Key, quote_values(c.New)))
+				} else if c.New == nil {
+					lines = append(lines, fmt.Sprintf("    %s removed: %s", c.Key, quote_values(c.Old)))
+				} else {
+					lines = append(lines, fmt.Sprintf("    %s: %s -> %s", c.Key, quote_values(c.Old), quote_values(c.New)))
+				}
+			}
+		}
+	}
+
+	if len(lines) == 0 {
+		return ""
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+
+func PathString(path []int) string {
+
+	// e.g. "0.1.0", or "root" for the empty path.
+
+	if len(path) == 0 {
+		return "root"
+	}
+
+	var parts []string
+	for _, n := range path {
+		parts = append(parts, fmt.Sprintf("%d", n))
+	}
+
+	return strings.Join(parts, ".")
+}
+
+
+func diff_props(old_node, new_node *Node, with_setup bool) []PropChange {
+
+	// Board-altering properties are ignored unless with_setup is set, since
+	// matched nodes agree on them. Setup point lists are compared as sets of
+	// points, so that a compressed list equals its expansion.
+
+	var keys []string
+	seen := make(map[string]bool)
+
+	for _, props := range []map[string][]string{old_node.Props, new_node.Props} {
+		for key, _ := range props {
+			if seen[key] == false && (with_setup || is_mutor(key) == false) {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+
+	sort.Strings(keys)
+
+	var ret []PropChange
+
+	for _, key := range keys {
+
+		old_values := old_node.AllValues(key)
+		new_values := new_node.AllValues(key)
+
+		same := false
+
+		if key == "AB" || key == "AW" || key == "AE" {
+			same = same_points(points_from_list(old_values, old_node.Size()), points_from_list(new_values, new_node.Size()))
+		} else {
+			same = same_value_set(old_values, new_values)
+		}
+
+		if same == false {
+			ret = append(ret, PropChange{Key: key, Old: old_values, New: new_values})
+		}
+	}
+
+	return ret
+}
+
+
+func same_value_set(a, b []string) bool {
+
+	if len(a) != len(b) {
+		return false
+	}
+
+	a = append([]string(nil), a...)
+	b = append([]string(nil), b...)
+
+	sort.Strings(a)
+	sort.Strings(b)
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+
+func same_points(a, b []Point) bool {
+
+	// Whether the lists hold the same points, ignoring order and repeats.
+
+	in_a := make(map[Point]bool)
+	in_b := make(map[Point]bool)
+
+	for _, p := range a {
+		in_a[p] = true
+	}
+
+	for _, p := range b {
+		if in_a[p] == false {
+			return false
+		}
+		in_b[p] = true
+	}
+
+	return len(in_a) == len(in_b)
+}
+
+
+func count_nodes(node *Node) int {
+
+	n := 0
+	stack := []*Node{node}
+
+	for len(stack) > 0 {
+		node = stack[len(stack) - 1]
+		stack = stack[:len(stack) - 1]
+		n++
+		stack = append(stack, node.Children...)
+	}
+
+	return n
+}
+
+
+func quote_values(values []string) string {
+
+	var parts []string
+	for _, v := range values {
+		parts = append(parts, fmt.Sprintf("%q", v))
+	}
+
+	return strings.Join(parts, " ")
+}
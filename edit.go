@@ -0,0 +1,146 @@
+package kikashi
+
+import (
+	"fmt"
+)
+
+// -------------------------------------------------------------------------
+// Structural editing of the tree. These keep Parent pointers consistent;
+// Paste() also rebuilds boards, since the subtree may now sit below a
+// different position.
+
+
+func (self *Node) MoveUp() {
+
+	// Swap places with the previous sibling.
+
+	if self.Parent == nil {
+		return
+	}
+
+	i := self.SiblingIndex()
+
+	if i > 0 {
+		siblings := self.Parent.Children
+		siblings[i], siblings[i - 1] = siblings[i - 1], siblings[i]
+	}
+}
+
+
+func (self *Node) MoveDown() {
+
+	// Swap places with the next sibling.
+
+	if self.Parent == nil {
+		return
+	}
+
+	i := self.SiblingIndex()
+
+	if i + 1 < len(self.Parent.Children) {
+		siblings := self.Parent.Children
+		siblings[i], siblings[i + 1] = siblings[i + 1], siblings[i]
+	}
+}
+
+
+func (self *Node) Promote() {
+
+	// Make this node the first of its siblings, keeping the others in order.
+
+	if self.Parent == nil {
+		return
+	}
+
+	i := self.SiblingIndex()
+	siblings := self.Parent.Children
+
+	copy(siblings[1:i + 1], siblings[0:i])
+	siblings[0] = self
+}
+
+
+func (self *Node) PromoteToMainLine() {
+
+	// Make the line from the root to this node the main line, i.e. the one
+	// GetEnd() follows. Only the ordering of children changes.
+
+	for node := self; node.Parent != nil; node = node.Parent {
+		node.Promote()
+	}
+}
+
+
+func (self *Node) Cut() *Node {
+
+	// Detach this node (and everything below it) from the tree. The node keeps
+	// its board, and can be given to Paste() later. Cutting the root does nothing.
+
+	if self.Parent == nil {
+		return self
+	}
+
+	self.Parent.RemoveChild(self)
+	self.Parent = nil
+	return self
+}
+
+
+func (self *Node) Paste(subtree *Node) error {
+
+	// Add the subtree as the last child of this node. If the subtree is still
+	// attached elsewhere, it is moved. Boards in the subtree are rebuilt.
+
+	if subtree == nil {
+		return fmt.Errorf("Paste(): nil subtree")
+	}
+
+	for node := self; node != nil; node = node.Parent {
+		if node == subtree {
+			return fmt.Errorf("Paste(): can't paste a node under itself")
+		}
+	}
+
+	if len(subtree.Board) != 0 && len(subtree.Board) != self.Size() {
+		return fmt.Errorf("Paste(): board size mismatch (%d vs %d)", len(subtree.Board), self.Size())
+	}
+
+	subtree.Cut()
+
+	subtree.Parent = self
+	self.Children = append(self.Children, subtree)
+
+	subtree.rebuild_boards()
+	return nil
+}
+
+
+func (self *Node) DeleteChildren() {
+
+	// Delete everything below this node.
+
+	for _, child := range self.Children {
+		child.Parent = nil
+	}
+
+	self.Children = nil
+	self.last_visited = nil
+}
+
+
+func (self *Node) rebuild_boards() {
+
+	// Forget cached sizes and remake every board in this subtree,
+	// e.g. because it was moved under a different position.
+
+	self.clear_size_cache()
+	self.make_board_recursive()
+}
+
+
+func (self *Node) clear_size_cache() {
+	self.WalkDepthFirst(func(node *Node, depth int) WalkAction {
+		node.SZ_cache = 0
+		return WALK_CONTINUE
+	}, nil)
+}
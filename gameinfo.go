@@ -0,0 +1,446 @@
+package kikashi
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// -------------------------------------------------------------------------
+// Typed access to the game-info properties in the root. Values we can't
+// parse are kept as they were and written back unchanged, unless the
+// corresponding field is changed.
+
+var GAME_INFO_KEYS = []string{
+	"PB", "PW", "BR", "WR", "KM", "HA", "RE", "DT", "TM", "OT", "RU", "EV", "RO", "PC", "SO",
+}
+
+type GameInfo struct {
+	PlayerBlack		string			// PB
+	PlayerWhite		string			// PW
+	RankBlack		string			// BR
+	RankWhite		string			// WR
+	Komi			float64			// KM
+	Handicap		int				// HA
+	Result			Result			// RE
+	Dates			[]GameDate		// DT
+	TimeLimit		float64			// TM, in seconds
+	Overtime		string			// OT
+	Rules			string			// RU
+	Event			string			// EV
+	Round			string			// RO
+	Place			string			// PC
+	Source			string			// SO
+
+	Unparsed		[]string		// Keys whose values couldn't be parsed.
+
+	raw				map[string]string		// Values as read, for round-tripping.
+	canon			map[string]string		// How we'd have written what we parsed from raw.
+}
+
+// -------------------------------------------------------------------------
+
+type Result struct {
+	Winner			Colour			// EMPTY if nobody won (or we don't know who).
+	Margin			float64			// Points. 0 if not a win on points, or not stated.
+	Resign			bool
+	Time			bool
+	Forfeit			bool
+	Draw			bool
+	Void			bool
+	Unknown			bool
+}
+
+
+func ParseResult(s string) (Result, error) {
+
+	s = strings.TrimSpace(s)
+
+	switch strings.ToLower(s) {
+	case "0", "draw", "jigo":
+		return Result{Draw: true}, nil
+	case "void":
+		return Result{Void: true}, nil
+	case "?":
+		return Result{Unknown: true}, nil
+	}
+
+	if len(s) < 2 || s[1] != '+' {
+		return Result{}, fmt.Errorf("ParseResult(): can't parse %q", s)
+	}
+
+	var ret Result
+
+	switch s[0] {
+	case 'B', 'b':
+		ret.Winner = BLACK
+	case 'W', 'w':
+		ret.Winner = WHITE
+	default:
+		return Result{}, fmt.Errorf("ParseResult(): can't parse %q", s)
+	}
+
+	tail := s[2:]
+
+	switch strings.ToLower(tail) {
+	case "":
+	case "r", "resign":
+		ret.Resign = true
+	case "t", "time":
+		ret.Time = true
+	case "f", "forfeit":
+		ret.Forfeit = true
+	default:
+		margin, err := strconv.ParseFloat(tail, 64)
+		if err != nil || margin < 0 || math.IsNaN(margin) || math.IsInf(margin, 0) {
+			return Result{}, fmt.Errorf("ParseResult(): can't parse %q", s)
+		}
+		ret.Margin = margin
+	}
+
+	return ret, nil
+}
+
+
+func (self Result) String() string {
+
+	if self.Draw {
+		return "0"
+	} else if self.Void {
+		return "Void"
+	} else if self.Unknown {
+		return "?"
+	} else if self.Winner != BLACK && self.Winner != WHITE {
+		return ""
+	}
+
+	s := COLMAP[self.Winner] + "+"
+
+	if self.Resign {
+		s += "R"
+	} else if self.Time {
+		s += "T"
+	} else if self.Forfeit {
+		s += "F"
+	} else if self.Margin != 0 {
+		s += FormatReal(self.Margin)
+	}
+
+	return s
+}
+
+// -------------------------------------------------------------------------
+
+type GameDate struct {
+	Year			int
+	Month			int				// 0 if not given.
+	Day				int				// 0 if not given.
+}
+
+
+func ParseDates(s string) ([]GameDate, error) {
+
+	// Handles the FF[4] shortcuts, e.g. "1996-05-06,07,08" and "1996-12-27,28,1997-01-03,04",
+	// where each partial date inherits the missing parts from the previous one.
+
+	var ret []GameDate
+	var prev GameDate
+
+	for _, part := range strings.Split(s, ",") {
+
+		part = strings.TrimSpace(part)
+		fields := strings.Split(part, "-")
+		nums := make([]int, len(fields))
+
+		for i, f := range fields {
+			n, err := strconv.Atoi(f)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("ParseDates(): can't parse %q", s)
+			}
+			nums[i] = n
+		}
+
+		d := prev
+
+		switch {
+		case len(fields) == 3 && len(fields[0]) == 4:
+			d = GameDate{nums[0], nums[1], nums[2]}
+		case len(fields) == 2 && len(fields[0]) == 4:
+			d = GameDate{nums[0], nums[1], 0}
+		case len(fields) == 2 && len(ret) > 0 && prev.Day != 0:
+			d = GameDate{prev.Year, nums[0], nums[1]}
+		case len(fields) == 1 && len(fields[0]) == 4:
+			d = GameDate{nums[0], 0, 0}
+		case len(fields) == 1 && len(ret) > 0 && prev.Day != 0:
+			d.Day = nums[0]
+		case len(fields) == 1 && len(ret) > 0 && prev.Month != 0:
+			d.Month = nums[0]
+		default:
+			return nil, fmt.Errorf("ParseDates(): can't parse %q", s)
+		}
+
+		if d.Valid() == false {
+			return nil, fmt.Errorf("ParseDates(): invalid date in %q", s)
+		}
+
+		ret = append(ret, d)
+		prev = d
+	}
+
+	return ret, nil
+}
+
+
+func (self GameDate) Valid() bool {
+
+	if self.Year < 1 || self.Month < 0 || self.Month > 12 || self.Day < 0 {
+		return false
+	}
+
+	if self.Day > 0 {
+		if self.Month == 0 {
+			return false
+		}
+		days := []int{31, 29, 31, 30, 31, 30, 31, 31, 30, 31, 30, 31}
+		if self.Day > days[self.Month - 1] {
+			return false
+		}
+	}
+
+	return true
+}
+
+
+func (self GameDate) String() string {
+
+	if self.Month == 0 {
+		return fmt.Sprintf("%04d", self.Year)
+	} else if self.Day == 0 {
+		return fmt.Sprintf("%04d-%02d", self.Year, self.Month)
+	}
+
+	return fmt.Sprintf("%04d-%02d-%02d", self.Year, self.Month, self.Day)
+}
+
+
+func DatesString(dates []GameDate) string {
+
+	// Always writes full dates, which is valid, if not the shortest form.
+
+	var parts []string
+	for _, d := range dates {
+		parts = append(parts, d.String())
+	}
+
+	return strings.Join(parts, ",")
+}
+
+// -------------------------------------------------------------------------
+
+func (self *Node) GetGameInfo() *GameInfo {
+
+	// Reads from the root, wherever this node is.
+
+	root := self.GetRoot()
+
+	info := &GameInfo{
+		raw: make(map[string]string),
+		canon: make(map[string]string),
+	}
+
+	for _, key := range GAME_INFO_KEYS {
+		if val, ok := root.GetValue(key); ok {
+			info.raw[key] = val
+		}
+	}
+
+	info.PlayerBlack = info.raw["PB"]
+	info.PlayerWhite = info.raw["PW"]
+	info.RankBlack = info.raw["BR"]
+	info.RankWhite = info.raw["WR"]
+	info.Overtime = info.raw["OT"]
+	info.Rules = info.raw["RU"]
+	info.Event = info.raw["EV"]
+	info.Round = info.raw["RO"]
+	info.Place = info.raw["PC"]
+	info.Source = info.raw["SO"]
+
+	if s, ok := info.raw["KM"]; ok {
+		v, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err == nil && math.IsNaN(v) == false && math.IsInf(v, 0) == false {
+			info.Komi = v
+			info.canon["KM"] = FormatReal(v)
+		} else {
+			info.Unparsed = append(info.Unparsed, "KM")
+		}
+	}
+
+	if s, ok := info.raw["HA"]; ok {
+		v, err := strconv.Atoi(strings.TrimSpace(s))
+		if err == nil {
+			info.Handicap = v
+			info.canon["HA"] = strconv.Itoa(v)
+		} else {
+			info.Unparsed = append(info.Unparsed, "HA")
+		}
+	}
+
+	if s, ok := info.raw["RE"]; ok {
+		v, err := ParseResult(s)
+		if err == nil {
+			info.Result = v
+			info.canon["RE"] = v.String()
+		} else {
+			info.Unparsed = append(info.Unparsed, "RE")
+		}
+	}
+
+	if s, ok := info.raw["DT"]; ok {
+		v, err := ParseDates(s)
+		if err == nil {
+			info.Dates = v
+			info.canon["DT"] = DatesString(v)
+		} else {
+			info.Unparsed = append(info.Unparsed, "DT")
+		}
+	}
+
+	if s, ok := info.raw["TM"]; ok {
+		v, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err == nil && math.IsNaN(v) == false && math.IsInf(v, 0) == false {
+			info.TimeLimit = v
+			info.canon["TM"] = FormatReal(v)
+		} else {
+			info.Unparsed = append(info.Unparsed, "TM")
+		}
+	}
+
+	return info
+}
+
+
+func (self *Node) SetGameInfo(info *GameInfo) error {
+
+	// Writes to the root, wherever this node is. Empty strings, and zero
+	// numbers that weren't present when read, delete the property.
+
+	errs := info.Validate()
+	if len(errs) > 0 {
+		return errs[0]
+	}
+
+	root := self.GetRoot()
+
+	for _, key := range GAME_INFO_KEYS {
+		value, present := info.encode(key)
+		if present {
+			root.SetValue(key, value)
+		} else {
+			root.DeleteKey(key)
+		}
+	}
+
+	return nil
+}
+
+
+func (self *GameInfo) Validate() []error {
+
+	// Checks the typed fields. Unparsed values are not errors in themselves;
+	// they are listed in Unparsed and preserved.
+
+	var errs []error
+
+	if math.IsNaN(self.Komi) || math.IsInf(self.Komi, 0) {
+		errs = append(errs, fmt.Errorf("GameInfo: komi is not a number"))
+	}
+
+	if self.Handicap < 0 || self.Handicap == 1 {
+		errs = append(errs, fmt.Errorf("GameInfo: invalid handicap %d", self.Handicap))
+	}
+
+	r := self.Result
+
+	if r.Margin < 0 || math.IsNaN(r.Margin) || math.IsInf(r.Margin, 0) {
+		errs = append(errs, fmt.Errorf("GameInfo: invalid result margin"))
+	}
+
+	if r.Winner != EMPTY && (r.Draw || r.Void || r.Unknown) {
+		errs = append(errs, fmt.Errorf("GameInfo: result has a winner but is a draw, void or unknown"))
+	}
+
+	if (r.Resign || r.Time || r.Forfeit || r.Margin != 0) && r.Winner == EMPTY {
+		errs = append(errs, fmt.Errorf("GameInfo: result has a winning method but no winner"))
+	}
+
+	for _, d := range self.Dates {
+		if d.Valid() == false {
+			errs = append(errs, fmt.Errorf("GameInfo: invalid date %v", d))
+		}
+	}
+
+	if self.TimeLimit < 0 || math.IsNaN(self.TimeLimit) || math.IsInf(self.TimeLimit, 0) {
+		errs = append(errs, fmt.Errorf("GameInfo: invalid time limit"))
+	}
+
+	return errs
+}
+
+
+func (self *GameInfo) encode(key string) (string, bool) {
+
+	switch key {
+	case "PB": return self.PlayerBlack, self.PlayerBlack != ""
+	case "PW": return self.PlayerWhite, self.PlayerWhite != ""
+	case "BR": return self.RankBlack, self.RankBlack != ""
+	case "WR": return self.RankWhite, self.RankWhite != ""
+	case "OT": return self.Overtime, self.Overtime != ""
+	case "RU": return self.Rules, self.Rules != ""
+	case "EV": return self.Event, self.Event != ""
+	case "RO": return self.Round, self.Round != ""
+	case "PC": return self.Place, self.Place != ""
+	case "SO": return self.Source, self.Source != ""
+	case "KM": return self.keep_raw(key, FormatReal(self.Komi), self.Komi != 0)
+	case "HA": return self.keep_raw(key, strconv.Itoa(self.Handicap), self.Handicap != 0)
+	case "RE": return self.keep_raw(key, self.Result.String(), self.Result.String() != "")
+	case "DT": return self.keep_raw(key, DatesString(self.Dates), len(self.Dates) > 0)
+	case "TM": return self.keep_raw(key, FormatReal(self.TimeLimit), self.TimeLimit != 0)
+	}
+
+	return "", false
+}
+
+
+func (self *GameInfo) keep_raw(key, canonical string, nonzero bool) (string, bool) {
+
+	// Decide what to write for a parsed property. If the field still holds
+	// what was read, the original text is written back as it was.
+
+	raw, had := self.raw[key]
+
+	if had {
+		if string_in_slice(key, self.Unparsed) && nonzero == false {
+			return raw, true
+		}
+		if self.canon[key] == canonical {
+			return raw, true
+		}
+		if canonical == "" {
+			return "", false
+		}
+		return canonical, true
+	}
+
+	return canonical, nonzero
+}
+
+
+func FormatReal(v float64) string {
+
+	// A real as SGF wants it: no exponent, and no trailing zeros. Exported so
+	// that other code writing reals (KM, TM, BL / WL...) writes them the same
+	// way as GameInfo does.
+
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
@@ -0,0 +1,200 @@
+package kikashi
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// -------------------------------------------------------------------------
+// Tygem .gib files. The header is a list of \[KEY=value\] lines between \HS
+// and \HE; the game is a list of commands between \GS and \GE, where
+//
+//		INI 0 1 <handicap> ...				starts the game
+//		STO 0 <number> <colour> <x> <y>		is a move (colour 1 = black, 2 = white)
+//		SKI 0 <number>						is a pass
+//
+// Coordinates are zeroth indexed from the top left, as ours are.
+
+var gib_rank_regexp = regexp.MustCompile(`^(.*?)\s*\(([^()]*)\)\s*$`)
+
+
+func LoadGIB(filename string) (*Node, error) {
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseGIB(data)
+}
+
+
+func ParseGIB(data []byte) (*Node, error) {
+
+	// If some moves were illegal, returns the tree anyway, with an IllegalMoves error.
+
+	header := make(map[string]string)
+	var commands [][]string
+
+	in_game := false
+
+	for _, line := range strings.Split(string(data), "\n") {
+
+		line = strings.TrimSpace(line)
+
+		if line == `\GS` {
+			in_game = true
+			continue
+		} else if line == `\GE` {
+			in_game = false
+			continue
+		}
+
+		if strings.HasPrefix(line, `\[`) && strings.HasSuffix(line, `\]`) {
+			kv := strings.SplitN(line[2:len(line) - 2], "=", 2)
+			if len(kv) == 2 {
+				header[kv[0]] = strings.TrimSpace(kv[1])
+			}
+			continue
+		}
+
+		if in_game {
+			fields := strings.Fields(line)
+			if len(fields) > 0 {
+				commands = append(commands, fields)
+			}
+		}
+	}
+
+	if len(commands) == 0 && len(header) == 0 {
+		return nil, fmt.Errorf("ParseGIB(): no game found")
+	}
+
+	handicap := 0
+
+	for _, fields := range commands {
+		if fields[0] == "INI" && len(fields) >= 4 {
+			handicap, _ = strconv.Atoi(fields[3])
+		}
+	}
+
+	root := new_import_root(19, handicap)
+	gib_header_to_root(header, root)
+
+	var illegal IllegalMoves
+	node := root
+
+	for _, fields := range commands {
+
+		switch fields[0] {
+
+		case "STO":
+
+			if len(fields) < 6 {
+				continue
+			}
+
+			number, _ := strconv.Atoi(fields[2])
+			c, err1 := strconv.Atoi(fields[3])
+			x, err2 := strconv.Atoi(fields[4])
+			y, err3 := strconv.Atoi(fields[5])
+
+			if err1 != nil || err2 != nil || err3 != nil || (c != 1 && c != 2) {
+				illegal = append(illegal, fmt.Errorf("unreadable move: %s", strings.Join(fields, " ")))
+				continue
+			}
+
+			colour := BLACK ; if c == 2 { colour = WHITE }
+			node = play_imported_move(node, colour, x, y, false, number, &illegal)
+
+		case "SKI":
+
+			node = node.TryPass(node.NextColour())
+		}
+	}
+
+	if len(illegal) > 0 {
+		return root, illegal
+	}
+
+	return root, nil
+}
+
+
+func gib_header_to_root(header map[string]string, root *Node) {
+
+	for _, pair := range [][3]string{
+		{"GAMEBLACKNAME", "PB", "BR"},
+		{"GAMEWHITENAME", "PW", "WR"},
+	} {
+		s, ok := header[pair[0]]
+		if ok == false || s == "" {
+			continue
+		}
+		if m := gib_rank_regexp.FindStringSubmatch(s); m != nil {
+			root.SetValue(pair[1], m[1])
+			root.SetValue(pair[2], m[2])
+		} else {
+			root.SetValue(pair[1], s)
+		}
+	}
+
+	if s := header["GAMENAME"]; s != "" {
+		root.SetValue("GN", s)
+	}
+
+	if s := header["GAMEPLACE"]; s != "" {
+		root.SetValue("PC", s)
+	}
+
+	if s := header["GAMEDATE"]; s != "" {
+		if date, ok := loose_date(s); ok {
+			root.SetValue("DT", date.String())
+		}
+	}
+
+	// GAMEINFOMAIN is a comma separated list of KEY:value. GONGJE is komi
+	// times 10, GRLT is the result code, ZIPSU is the margin times 10.
+
+	info := make(map[string]string)
+
+	for _, item := range strings.Split(header["GAMEINFOMAIN"], ",") {
+		kv := strings.SplitN(item, ":", 2)
+		if len(kv) == 2 {
+			info[kv[0]] = kv[1]
+		}
+	}
+
+	if s, ok := info["GONGJE"]; ok {
+		if v, err := strconv.Atoi(s); err == nil {
+			root.SetValue("KM", FormatReal(float64(v) / 10))
+		}
+	}
+
+	if s, ok := info["GRLT"]; ok {
+
+		var result string
+
+		switch s {
+		case "0": result = "B+"
+		case "1": result = "W+"
+		case "3": result = "B+R"
+		case "4": result = "W+R"
+		case "7": result = "B+T"
+		case "8": result = "W+T"
+		}
+
+		if result == "B+" || result == "W+" {
+			if v, err := strconv.Atoi(info["ZIPSU"]); err == nil && v > 0 {
+				result += FormatReal(float64(v) / 10)
+			}
+		}
+
+		if result != "" {
+			root.SetValue("RE", result)
+		}
+	}
+}
@@ -0,0 +1,423 @@
+package gtp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	k "github.com/fohristiwhirl/kikashi"
+)
+
+// -------------------------------------------------------------------------
+// The client. Commands are sent with ids, and each reply is matched to its
+// command by id, so a reply that arrives after its command timed out is
+// discarded rather than mistaken for the next one. Engines that don't echo
+// ids still reply in order, so a reply without one is taken to belong to
+// the oldest command that timed out, if any.
+
+type Engine struct {
+	Timeout			time.Duration			// For each command. 0 means wait forever.
+
+	cmd				*exec.Cmd				// nil if the engine isn't a process we started.
+	stdin			io.Writer
+	replies			chan reply
+	stderr			LineBuffer
+	mutex			sync.Mutex
+	next_id			int
+	timed_out		[]int					// Ids of commands that timed out and haven't had a reply yet.
+	read_err		error					// Set before replies is closed.
+	readers			sync.WaitGroup			// The goroutines reading stdout and stderr.
+	node			*k.Node					// The position the engine has, as far as Sync() knows.
+}
+
+type reply struct {
+	id				int						// -1 if the engine didn't send one.
+	success			bool
+	text			string
+}
+
+type Failure struct {						// The engine replied with "?".
+	Command			string
+	Message			string
+}
+
+type Timeout struct {
+	Command			string
+}
+
+type LineBuffer struct {					// As kizzie's.
+	sync.Mutex
+	Lines			[]string
+}
+
+
+func (self *Failure) Error() string {
+	return fmt.Sprintf("%s: %s", self.Command, self.Message)
+}
+
+
+func (self *Timeout) Error() string {
+	return fmt.Sprintf("%s: timed out", self.Command)
+}
+
+
+func (self *LineBuffer) Dump() []string {
+
+	self.Lock()
+	defer self.Unlock()
+
+	ret := self.Lines
+	self.Lines = nil
+	return ret
+}
+
+
+func Start(path string, args ...string) (*Engine, error) {
+
+	// Start an engine process. Its stderr is collected; see Stderr().
+
+	cmd := exec.Command(path, args...)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		return nil, err
+	}
+
+	engine := NewEngine(stdout, stdin)
+	engine.cmd = cmd
+
+	engine.readers.Add(1)
+
+	go func() {
+
+		defer engine.readers.Done()
+
+		scanner := bufio.NewScanner(stderr)
+		scanner.Buffer(make([]byte, 0, 64 * 1024), 1024 * 1024)
+
+		for scanner.Scan() {
+			engine.stderr.Lock()
+			engine.stderr.Lines = append(engine.stderr.Lines, scanner.Text())
+			engine.stderr.Unlock()
+		}
+
+		io.Copy(ioutil.Discard, stderr)			// If the scanner gave up (e.g. a huge line), keep draining so the engine doesn't block.
+	}()
+
+	return engine, nil
+}
+
+
+func NewEngine(r io.Reader, w io.Writer) *Engine {
+
+	// A client talking over any reader and writer, e.g. pipes to an engine
+	// in the same program. Start() is the usual way to get one.
+
+	engine := &Engine{
+		stdin: w,
+		replies: make(chan reply, 16),
+		next_id: 1,
+	}
+
+	engine.readers.Add(1)
+
+	go func() {
+		defer engine.readers.Done()
+		engine.read_loop(r)
+	}()
+
+	return engine
+}
+
+
+func (self *Engine) read_loop(r io.Reader) {
+
+	// A reply is "=" or "?", an optional id, then text, ending with an
+	// empty line. Anything before the "=" or "?" is ignored.
+
+	reader := bufio.NewReader(r)
+
+	var current *reply
+	var lines []string
+
+	for {
+
+		line, err := reader.ReadString('\n')
+		line = strings.TrimRight(line, "\r\n")
+
+		if current == nil && (strings.HasPrefix(line, "=") || strings.HasPrefix(line, "?")) {
+
+			current = &reply{id: -1, success: line[0] == '='}
+
+			rest := line[1:]
+			n := 0
+			for n < len(rest) && rest[n] >= '0' && rest[n] <= '9' {
+				n++
+			}
+			if n > 0 {
+				current.id, _ = strconv.Atoi(rest[:n])
+			}
+
+			lines = []string{strings.TrimSpace(rest[n:])}
+
+		} else if current != nil {
+
+			if line == "" {
+				current.text = strings.Join(lines, "\n")
+				self.replies <- *current
+				current = nil
+			} else {
+				lines = append(lines, line)
+			}
+		}
+
+		if err != nil {
+			if current != nil {							// Unterminated final reply.
+				current.text = strings.Join(lines, "\n")
+				self.replies <- *current
+			}
+			self.read_err = err
+			close(self.replies)
+			return
+		}
+	}
+}
+
+
+func (self *Engine) Send(command string) (string, error) {
+	return self.SendTimeout(command, self.Timeout)
+}
+
+
+func (self *Engine) SendTimeout(command string, timeout time.Duration) (string, error) {
+
+	// Send a command and wait for its reply. If the engine fails the
+	// command, the error is a *Failure; if it takes too long, a *Timeout.
+
+	command = strings.TrimSpace(command)
+
+	if command == "" || strings.ContainsAny(command, "\r\n") {
+		return "", fmt.Errorf("SendTimeout(): bad command %q", command)
+	}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	id := self.next_id
+	self.next_id++
+
+	_, err := fmt.Fprintf(self.stdin, "%d %s\n", id, command)
+	if err != nil {
+		return "", err
+	}
+
+	var timer <-chan time.Time
+	if timeout > 0 {
+		timer = time.After(timeout)
+	}
+
+	for {
+
+		select {
+
+		case r, ok := <-self.replies:
+
+			if ok == false {
+				return "", fmt.Errorf("%s: engine closed the connection (%v)", command, self.read_err)
+			}
+
+			if r.id != id && self.late_reply(r.id) {
+				continue
+			}
+
+			if r.success == false {
+				return "", &Failure{Command: command, Message: r.text}
+			}
+
+			return r.text, nil
+
+		case <-timer:
+
+			self.timed_out = append(self.timed_out, id)
+			return "", &Timeout{Command: command}
+		}
+	}
+}
+
+
+func (self *Engine) late_reply(id int) bool {
+
+	// Whether a reply belongs to a command that timed out, in which case it
+	// is forgotten. Call with the mutex held.
+
+	if len(self.timed_out) == 0 {
+		return id != -1
+	}
+
+	if id == -1 {
+		self.timed_out = self.timed_out[1:]
+		return true
+	}
+
+	for i, n := range self.timed_out {
+		if n == id {
+			self.timed_out = append(self.timed_out[:i], self.timed_out[i + 1:]...)
+			return true
+		}
+	}
+
+	return true									// Not ours, and not expected at all.
+}
+
+
+func (self *Engine) SendAll(commands []string) error {
+
+	// e.g. node.FullGTP(). Stops at the first error.
+
+	for _, command := range commands {
+		_, err := self.Send(command)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+
+func (self *Engine) Sync(node *k.Node) error {
+
+	// Bring the engine to the given position, as cheaply as we know how:
+	// one step forward or back from the last synced node if possible,
+	// otherwise the whole line from the root.
+
+	var err error
+
+	if node == self.node {
+		return nil
+	} else if self.node != nil && node.Parent == self.node {
+		err = self.SendAll(node.StepGTP())
+	} else if self.node != nil && self.node.Parent == node {
+		for range self.node.StepGTP() {
+			if _, err = self.Send("undo"); err != nil {
+				break
+			}
+		}
+	} else {
+		err = self.SendAll(node.FullGTP())
+	}
+
+	if err != nil {
+		self.node = nil					// Unknown state; resync fully next time.
+		return err
+	}
+
+	self.node = node
+	return nil
+}
+
+
+func (self *Engine) Play(mv k.Move) error {
+
+	_, err := self.Send(fmt.Sprintf("play %s %s", k.COLMAP[mv.Colour], VertexString(mv)))
+	if err == nil {
+		self.node = nil
+	}
+	return err
+}
+
+
+func (self *Engine) GenMove(colour k.Colour, size int) (mv k.Move, resign bool, err error) {
+	return self.GenMoveTimeout(colour, size, self.Timeout)
+}
+
+
+func (self *Engine) GenMoveTimeout(colour k.Colour, size int, timeout time.Duration) (mv k.Move, resign bool, err error) {
+
+	// Ask the engine for a move. Resignation is not a Move, so it's
+	// reported separately.
+
+	text, err := self.SendTimeout(fmt.Sprintf("genmove %s", k.COLMAP[colour]), timeout)
+	if err != nil {
+		return k.Move{}, false, err
+	}
+
+	self.node = nil
+
+	if strings.ToLower(strings.TrimSpace(text)) == "resign" {
+		return k.Move{}, true, nil
+	}
+
+	x, y, pass, ok := ParseVertex(text, size)
+	if ok == false {
+		return k.Move{}, false, fmt.Errorf("genmove: bad vertex %q", text)
+	}
+
+	return k.Move{OK: true, Pass: pass, Colour: colour, X: x, Y: y, Size: size}, false, nil
+}
+
+
+func (self *Engine) Stderr() []string {
+
+	// Lines the engine has written to stderr since the last call.
+
+	return self.stderr.Dump()
+}
+
+
+func (self *Engine) Close() error {
+
+	// Send quit, then wait a little for the process to exit before killing
+	// it. Wait() must not be called until the readers are done with the
+	// pipes, so we wait for them first; they finish when the process exits.
+
+	self.SendTimeout("quit", 5 * time.Second)
+
+	if closer, ok := self.stdin.(io.Closer); ok {
+		closer.Close()
+	}
+
+	if self.cmd == nil {
+		return nil
+	}
+
+	go func() {
+		for range self.replies {}				// So the stdout reader can't block on a full channel.
+	}()
+
+	done := make(chan bool)
+	go func() {
+		self.readers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		self.cmd.Process.Kill()
+		<-done
+	}
+
+	return self.cmd.Wait()
+}
@@ -0,0 +1,71 @@
+package gtp
+
+import (
+	"strings"
+
+	k "github.com/fohristiwhirl/kikashi"
+)
+
+// -------------------------------------------------------------------------
+// Go Text Protocol (version 2): a client for driving engines, a server for
+// exposing a kikashi tree as an engine, and a referee for engine matches.
+// This file has the parts they share.
+
+
+func ParseColour(s string) (k.Colour, bool) {
+
+	switch strings.ToLower(s) {
+	case "b", "black":
+		return k.BLACK, true
+	case "w", "white":
+		return k.WHITE, true
+	}
+
+	return k.EMPTY, false
+}
+
+
+func ParseVertex(s string, size int) (x int, y int, pass bool, ok bool) {
+
+	// Case-insensitive, as the spec requires. "resign" is not a vertex.
+
+	if strings.ToUpper(strings.TrimSpace(s)) == "PASS" {
+		return 0, 0, true, true
+	}
+
+	x, y, ok = k.CoordFormat{System: k.COORD_GTP}.PointFromString(s, size)
+	return x, y, false, ok
+}
+
+
+func VertexString(mv k.Move) string {
+
+	if mv.Pass {
+		return "pass"
+	}
+
+	return k.CoordFormat{System: k.COORD_GTP}.StringFromPoint(mv.X, mv.Y, mv.Size)
+}
+
+
+func clean_line(s string) string {
+
+	// The spec's preprocessing: drop control characters other than tab and
+	// newline, turn tabs into spaces, and remove comments.
+
+	s = strings.Map(func(r rune) rune {
+		if r == '\t' {
+			return ' '
+		}
+		if r < 32 && r != '\n' || r == 127 {
+			return -1
+		}
+		return r
+	}, s)
+
+	if i := strings.Index(s, "#"); i >= 0 {
+		s = s[:i]
+	}
+
+	return strings.TrimSpace(s)
+}
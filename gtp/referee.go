@@ -0,0 +1,378 @@
+package gtp
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	k "github.com/fohristiwhirl/kikashi"
+)
+
+// -------------------------------------------------------------------------
+// The referee: plays two engines against each other, like gogui-twogtp.
+// Every move is checked with TryMove() before the other engine sees it.
+// An engine that makes an illegal move, or fails a command it must obey,
+// loses by forfeit. Games ending in two passes are scored by AreaResult(),
+// i.e. with every stone counted as alive, so engines should be set to
+// play out their games (capture dead stones) for the score to be right.
+
+type Match struct {
+	Black			*Engine
+	White			*Engine
+	Size			int						// 0 means 19.
+	Komi			float64
+	Handicap		int						// Fixed handicap stones, placed with fixed_handicap.
+	MainTime		time.Duration			// Time controls, sent with time_settings: main time, then
+	ByoYomiTime		time.Duration			// Canadian byo-yomi of ByoYomiStones moves in ByoYomiTime.
+	ByoYomiStones	int						// All 0 means no time limit.
+	Lag				time.Duration			// Extra time allowed per move, for communication.
+	MaxMoves		int						// The game is stopped, unscored, after this many. 0 means 3 * size * size.
+	Alternate		bool					// In Run(), swap colours every game.
+	Event			string
+	Rules			string
+}
+
+type clock struct {
+	main			time.Duration
+	period			time.Duration			// Left in the current byo-yomi period.
+	stones			int						// Moves left to play in the current period.
+	in_byo_yomi		bool
+	full_period		time.Duration
+	full_stones		int
+}
+
+
+func (self *Match) Run(games int, filename_prefix string) ([]k.Result, error) {
+
+	// Play a number of games, saving each as <prefix>-001.sgf etc. unless the
+	// prefix is "". Stops at the first error that isn't an engine's fault.
+
+	var results []k.Result
+
+	for i := 0; i < games; i++ {
+
+		m := *self
+		if self.Alternate && i % 2 == 1 {
+			m.Black, m.White = self.White, self.Black
+		}
+
+		root, err := m.Play()
+		if err != nil {
+			return results, err
+		}
+
+		info := root.GetGameInfo()
+		results = append(results, info.Result)
+
+		if filename_prefix != "" {
+			err = root.Save(fmt.Sprintf("%s-%03d.sgf", filename_prefix, i + 1))
+			if err != nil {
+				return results, err
+			}
+		}
+	}
+
+	return results, nil
+}
+
+
+func (self *Match) Play() (*k.Node, error) {
+
+	// Play one game, returning its record with the game info filled in.
+	// The error is only for problems setting up; an engine misbehaving
+	// during the game just loses it.
+
+	size := self.Size
+	if size == 0 {
+		size = 19
+	}
+
+	max_moves := self.MaxMoves
+	if max_moves == 0 {
+		max_moves = 3 * size * size
+	}
+
+	timed := self.MainTime > 0 || self.ByoYomiTime > 0
+
+	engines := map[k.Colour]*Engine{k.BLACK: self.Black, k.WHITE: self.White}
+	clocks := map[k.Colour]*clock{k.BLACK: self.new_clock(), k.WHITE: self.new_clock()}
+
+	// Set up the engines...
+
+	for _, colour := range []k.Colour{k.BLACK, k.WHITE} {
+
+		e := engines[colour]
+
+		for _, command := range []string{fmt.Sprintf("boardsize %d", size), "clear_board", fmt.Sprintf("komi %s", k.FormatReal(self.Komi))} {
+			if _, err := e.Send(command); err != nil {
+				return nil, fmt.Errorf("Play(): %s engine: %v", k.COLMAP[colour], err)
+			}
+		}
+
+		if timed {
+			e.Send(fmt.Sprintf("time_settings %d %d %d",		// Not required by the spec, so failure is ignored.
+				int(self.MainTime.Seconds()), int(self.ByoYomiTime.Seconds()), self.ByoYomiStones))
+		}
+	}
+
+	props := map[string][]string{
+		"SZ": []string{fmt.Sprintf("%d", size)},
+		"GM": []string{"1"},
+		"FF": []string{"4"},
+	}
+
+	if self.Handicap >= 2 {
+
+		points := k.HandicapPoints(size, self.Handicap)
+		if points == nil {
+			return nil, fmt.Errorf("Play(): no fixed handicap of %d on %dx%d", self.Handicap, size, size)
+		}
+
+		for _, p := range points {
+			props["AB"] = append(props["AB"], p.SGFString())
+		}
+		props["PL"] = []string{"W"}
+
+		for _, colour := range []k.Colour{k.BLACK, k.WHITE} {
+			if _, err := engines[colour].Send(fmt.Sprintf("fixed_handicap %d", self.Handicap)); err != nil {
+				return nil, fmt.Errorf("Play(): %s engine: %v", k.COLMAP[colour], err)
+			}
+		}
+	}
+
+	root := k.NewNode(nil, props)
+	node := root
+
+	info := root.GetGameInfo()
+	info.PlayerBlack = engine_name(self.Black)
+	info.PlayerWhite = engine_name(self.White)
+	info.Komi = self.Komi
+	if self.Handicap >= 2 {
+		info.Handicap = self.Handicap
+	}
+	info.Rules = self.Rules
+	info.Event = self.Event
+	info.TimeLimit = self.MainTime.Seconds()
+
+	now := time.Now()
+	info.Dates = []k.GameDate{{Year: now.Year(), Month: int(now.Month()), Day: now.Day()}}
+
+	if self.ByoYomiTime > 0 {
+		info.Overtime = fmt.Sprintf("%d/%d Canadian", self.ByoYomiStones, int(self.ByoYomiTime.Seconds()))
+	}
+
+	// The game...
+
+	var result k.Result
+	var comment string
+
+	colour := root.NextColour()
+	passes := 0
+	moves := 0
+
+	for {
+
+		if moves >= max_moves {
+			result = k.Result{Unknown: true}
+			comment = fmt.Sprintf("Stopped after %d moves", moves)
+			break
+		}
+
+		e := engines[colour]
+		other := engines[colour.Opposite()]
+		c := clocks[colour]
+
+		timeout := e.Timeout
+
+		if timed {
+			e.Send(c.time_left_command(colour))
+			timeout = c.allowance() + self.Lag
+		}
+
+		start := time.Now()
+		mv, resign, err := e.GenMoveTimeout(colour, size, timeout)
+		elapsed := time.Since(start)
+
+		// Only a clock can lose the game on time. Without one, an engine that
+		// times out (see Engine.Timeout) has failed, and forfeits below.
+
+		if timed {
+
+			_, timeout := err.(*Timeout)
+
+			if timeout || (err == nil && c.use(elapsed - self.Lag) == false) {
+				result = k.Result{Winner: colour.Opposite(), Time: true}
+				comment = fmt.Sprintf("%s lost on time", colour.Name())
+				break
+			}
+		}
+
+		if err != nil {
+			result = k.Result{Winner: colour.Opposite(), Forfeit: true}
+			comment = fmt.Sprintf("%s forfeits: %v", colour.Name(), err)
+			break
+		}
+
+		if resign {
+			result = k.Result{Winner: colour.Opposite(), Resign: true}
+			comment = fmt.Sprintf("%s resigned", colour.Name())
+			break
+		}
+
+		if mv.Pass {
+			node = node.TryPass(colour)
+			passes++
+		} else {
+			next, err := node.TryMove(colour, mv.X, mv.Y)
+			if err != nil {
+				result = k.Result{Winner: colour.Opposite(), Forfeit: true}
+				comment = fmt.Sprintf("%s forfeits: illegal move %s (%v)", colour.Name(), VertexString(mv), err)
+				break
+			}
+			node = next
+			passes = 0
+		}
+
+		moves++
+
+		if timed {
+			c.annotate(node, colour)
+		}
+
+		if passes >= 2 {
+			result = node.AreaResult(self.Komi)
+			comment = "Scored by area, with all stones alive"
+			break
+		}
+
+		if err := other.Play(mv); err != nil {
+			result = k.Result{Winner: colour, Forfeit: true}
+			comment = fmt.Sprintf("%s forfeits: refused %s %s (%v)", colour.Opposite().Name(), k.COLMAP[colour], VertexString(mv), err)
+			break
+		}
+
+		colour = colour.Opposite()
+	}
+
+	info.Result = result
+
+	if err := root.SetGameInfo(info); err != nil {
+		return nil, err
+	}
+
+	node.SetValue("C", comment)
+	return root, nil
+}
+
+
+func (self *Match) new_clock() *clock {
+
+	c := &clock{
+		main: self.MainTime,
+		full_period: self.ByoYomiTime,
+		full_stones: self.ByoYomiStones,
+	}
+
+	c.reset_period()
+	return c
+}
+
+
+func (self *clock) allowance() time.Duration {
+
+	// The most time the next move may take.
+
+	if self.in_byo_yomi {
+		return self.period
+	}
+
+	return self.main + self.period
+}
+
+
+func (self *clock) use(elapsed time.Duration) bool {
+
+	// Charge a move's time to the clock; false if the player has run out.
+
+	if elapsed < 0 {
+		elapsed = 0
+	}
+
+	if self.in_byo_yomi == false {
+
+		if elapsed <= self.main {
+			self.main -= elapsed
+			return true
+		}
+
+		elapsed -= self.main
+		self.main = 0
+
+		if self.period == 0 {
+			return false
+		}
+
+		self.in_byo_yomi = true
+	}
+
+	self.period -= elapsed
+
+	if self.period < 0 {
+		return false
+	}
+
+	self.stones--
+
+	if self.stones <= 0 {
+		self.reset_period()
+	}
+
+	return true
+}
+
+
+func (self *clock) reset_period() {
+	self.period = self.full_period
+	self.stones = self.full_stones
+}
+
+
+func (self *clock) time_left_command(colour k.Colour) string {
+
+	if self.in_byo_yomi {
+		return fmt.Sprintf("time_left %s %d %d", k.COLMAP[colour], int(self.period.Seconds()), self.stones)
+	}
+
+	return fmt.Sprintf("time_left %s %d 0", k.COLMAP[colour], int(self.main.Seconds()))
+}
+
+
+func (self *clock) annotate(node *k.Node, colour k.Colour) {
+
+	// BL / WL (time left) and OB / OW (byo-yomi moves left) after a move.
+
+	key := "B" ; if colour == k.WHITE { key = "W" }
+
+	if self.in_byo_yomi {
+		node.SetValue(key + "L", k.FormatReal(math.Round(self.period.Seconds() * 10) / 10))
+		node.SetValue("O" + key, fmt.Sprintf("%d", self.stones))
+	} else {
+		node.SetValue(key + "L", k.FormatReal(math.Round(self.main.Seconds() * 10) / 10))
+	}
+}
+
+
+func engine_name(e *Engine) string {
+
+	name, err := e.Send("name")
+	if err != nil {
+		return "?"
+	}
+
+	if version, err := e.Send("version"); err == nil && version != "" {
+		name += " " + version
+	}
+
+	return strings.TrimSpace(name)
+}
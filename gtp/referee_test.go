@@ -0,0 +1,133 @@
+package gtp
+
+import (
+	"testing"
+	"time"
+
+	k "github.com/fohristiwhirl/kikashi"
+)
+
+type slow_generator struct {
+	delay			time.Duration
+}
+
+
+func (self slow_generator) GenMove(node *k.Node, colour k.Colour) (k.Move, bool) {
+	time.Sleep(self.delay)
+	return RandomGenerator{}.GenMove(node, colour)
+}
+
+
+func local_pair(black, white MoveGenerator) (*Server, *Server, *Engine, *Engine) {
+
+	b := NewServer(19)
+	b.Generator = black
+
+	w := NewServer(19)
+	w.Generator = white
+
+	return b, w, LocalEngine(b), LocalEngine(w)
+}
+
+
+func TestMatchUntimed(t *testing.T) {
+
+	bs, ws, b, w := local_pair(RandomGenerator{}, RandomGenerator{})
+	defer b.Close()
+	defer w.Close()
+
+	m := Match{Black: b, White: w, Size: 9, Komi: 7.5}
+
+	root, err := m.Play()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info := root.GetGameInfo()
+
+	if info.Result.String() == "" || info.Result.Time || info.Result.Forfeit {
+		t.Errorf("unexpected result %q", info.Result.String())
+	}
+
+	if info.Komi != 7.5 || root.Size() != 9 {
+		t.Errorf("record has komi %v, size %d", info.Komi, root.Size())
+	}
+
+	// Both engines must have been kept in step with the record...
+
+	end := root.GetEnd()
+
+	if bs.Node.SameBoard(end) == false || ws.Node.SameBoard(end) == false {
+		t.Errorf("engines' boards differ from the record")
+	}
+
+	if _, ok := end.GetValue("C"); ok == false {
+		t.Errorf("no comment on the final node")
+	}
+}
+
+
+func TestMatchTimed(t *testing.T) {
+
+	_, _, b, w := local_pair(RandomGenerator{}, RandomGenerator{})
+	defer b.Close()
+	defer w.Close()
+
+	m := Match{Black: b, White: w, Size: 9, MainTime: 10 * time.Second, MaxMoves: 20}
+
+	root, err := m.Play()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result := root.GetGameInfo().Result; result.Unknown == false {
+		t.Errorf("result %q, want the game stopped after MaxMoves", result.String())
+	}
+
+	if _, ok := root.Children[0].GetValue("BL"); ok == false {
+		t.Errorf("moves are not annotated with the time left")
+	}
+}
+
+
+func TestMatchTimeLoss(t *testing.T) {
+
+	_, _, b, w := local_pair(slow_generator{50 * time.Millisecond}, RandomGenerator{})
+	defer b.Close()
+	defer w.Close()
+
+	m := Match{Black: b, White: w, Size: 9, MainTime: 120 * time.Millisecond}
+
+	root, err := m.Play()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result := root.GetGameInfo().Result; result.Winner != k.WHITE || result.Time == false {
+		t.Errorf("result %q, want W+T", result.String())
+	}
+}
+
+
+func TestMatchTimeoutWithoutClock(t *testing.T) {
+
+	// Without time controls, an engine that times out forfeits; it can't
+	// lose on time.
+
+	_, _, b, w := local_pair(slow_generator{200 * time.Millisecond}, RandomGenerator{})
+	defer b.Close()
+	defer w.Close()
+
+	b.Timeout = 20 * time.Millisecond
+
+	m := Match{Black: b, White: w, Size: 9}
+
+	root, err := m.Play()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result := root.GetGameInfo().Result; result.Winner != k.WHITE || result.Forfeit == false {
+		t.Errorf("result %q, want W+F", result.String())
+	}
+}
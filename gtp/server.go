@@ -0,0 +1,533 @@
+package gtp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+
+	k "github.com/fohristiwhirl/kikashi"
+)
+
+// -------------------------------------------------------------------------
+// The server: a kikashi tree behind a GTP interface. The rules are
+// TryMove()'s. Moves are added to the tree as they're played, so after a
+// game, Server.Node.GetRoot() is the record. The engine's own moves come
+// from a MoveGenerator; without one, genmove isn't offered.
+
+type MoveGenerator interface {
+	GenMove(node *k.Node, colour k.Colour) (mv k.Move, resign bool)
+}
+
+type Handler func(server *Server, args []string) (string, error)
+
+type Server struct {
+	Name			string
+	Version			string
+	Generator		MoveGenerator
+	Node			*k.Node
+	Komi			float64
+	handlers		map[string]Handler
+	created			map[*k.Node]bool		// Nodes the server added to the tree, which undo may remove.
+}
+
+type RandomGenerator struct{}			// Plays randomly, but won't fill its own eyes; passes when out of moves.
+
+
+func NewServer(size int) *Server {
+
+	self := &Server{
+		Name: "kikashi",
+		Version: "1",
+		Node: k.NewTree(size),
+		handlers: make(map[string]Handler),
+	}
+
+	for name, handler := range map[string]Handler{
+		"protocol_version":	func(s *Server, args []string) (string, error) { return "2", nil },
+		"name":				func(s *Server, args []string) (string, error) { return s.Name, nil },
+		"version":			func(s *Server, args []string) (string, error) { return s.Version, nil },
+		"quit":				func(s *Server, args []string) (string, error) { return "", nil },
+		"known_command":	cmd_known_command,
+		"list_commands":	cmd_list_commands,
+		"boardsize":		cmd_boardsize,
+		"clear_board":		cmd_clear_board,
+		"komi":				cmd_komi,
+		"fixed_handicap":	cmd_fixed_handicap,
+		"play":				cmd_play,
+		"genmove":			cmd_genmove,
+		"undo":				cmd_undo,
+		"showboard":		cmd_showboard,
+		"final_score":		cmd_final_score,
+		"loadsgf":			cmd_loadsgf,
+		"printsgf":			cmd_printsgf,
+	} {
+		self.handlers[name] = handler
+	}
+
+	return self
+}
+
+
+func (self *Server) Handle(name string, handler Handler) {
+
+	// Add a command, or replace a built-in one.
+
+	self.handlers[name] = handler
+}
+
+
+func (self *Server) known(name string) bool {
+	if name == "genmove" && self.Generator == nil {
+		return false
+	}
+	_, ok := self.handlers[name]
+	return ok
+}
+
+
+func (self *Server) Command(line string) (string, error) {
+
+	// Run one command (without an id). Also usable directly, e.g. in tests.
+
+	fields := strings.Fields(clean_line(line))
+
+	if len(fields) == 0 {
+		return "", fmt.Errorf("empty command")
+	}
+
+	name := strings.ToLower(fields[0])
+
+	if self.known(name) == false {
+		return "", fmt.Errorf("unknown command")
+	}
+
+	return self.handlers[name](self, fields[1:])
+}
+
+
+func (self *Server) Serve(r io.Reader, w io.Writer) error {
+
+	// Read commands until quit or EOF, writing a reply to each.
+
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+
+		line := clean_line(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		id := ""
+		fields := strings.SplitN(line, " ", 2)
+		if _, err := strconv.Atoi(fields[0]); err == nil {
+			id = fields[0]
+			line = ""
+			if len(fields) > 1 {
+				line = fields[1]
+			}
+		}
+
+		text, err := self.Command(line)
+
+		var reply string
+		if err != nil {
+			reply = fmt.Sprintf("?%s %s", id, err.Error())
+		} else {
+			reply = fmt.Sprintf("=%s %s", id, text)
+		}
+
+		// A reply can't contain an empty line, since that would end it.
+
+		lines := strings.Split(strings.TrimRight(reply, "\n "), "\n")
+		for i := range lines {
+			if lines[i] == "" {
+				lines[i] = " "
+			}
+		}
+		reply = strings.Join(lines, "\n")
+
+		_, err = fmt.Fprintf(w, "%s\n\n", reply)
+		if err != nil {
+			return err
+		}
+
+		if strings.ToLower(strings.TrimSpace(line)) == "quit" {
+			return nil
+		}
+	}
+
+	return scanner.Err()
+}
+
+
+func LocalEngine(server *Server) *Engine {
+
+	// A client connected to a server in this program, e.g. to stand in for
+	// a real engine when testing. Close() the client to stop the server.
+
+	client_r, server_w := io.Pipe()
+	server_r, client_w := io.Pipe()
+
+	go func() {
+		server.Serve(server_r, server_w)
+		server_w.Close()
+		server_r.Close()
+	}()
+
+	return NewEngine(client_r, client_w)
+}
+
+// -------------------------------------------------------------------------
+
+func cmd_known_command(s *Server, args []string) (string, error) {
+	if len(args) > 0 && s.known(strings.ToLower(args[0])) {
+		return "true", nil
+	}
+	return "false", nil
+}
+
+
+func cmd_list_commands(s *Server, args []string) (string, error) {
+
+	var names []string
+	for name := range s.handlers {
+		if s.known(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	return strings.Join(names, "\n"), nil
+}
+
+
+func cmd_boardsize(s *Server, args []string) (string, error) {
+
+	if len(args) < 1 {
+		return "", fmt.Errorf("syntax error")
+	}
+
+	size, err := strconv.Atoi(args[0])
+	if err != nil {
+		return "", fmt.Errorf("syntax error")
+	}
+
+	if size < 1 || size > 25 {
+		return "", fmt.Errorf("unacceptable size")
+	}
+
+	s.Node = k.NewTree(size)
+	s.set_komi_property()
+	return "", nil
+}
+
+
+func cmd_clear_board(s *Server, args []string) (string, error) {
+	s.Node = k.NewTree(s.Node.Size())
+	s.set_komi_property()
+	return "", nil
+}
+
+
+func cmd_komi(s *Server, args []string) (string, error) {
+
+	if len(args) < 1 {
+		return "", fmt.Errorf("syntax error")
+	}
+
+	komi, err := strconv.ParseFloat(args[0], 64)
+	if err != nil {
+		return "", fmt.Errorf("syntax error")
+	}
+
+	s.Komi = komi
+	s.set_komi_property()
+	return "", nil
+}
+
+
+func cmd_fixed_handicap(s *Server, args []string) (string, error) {
+
+	// Only allowed on an empty board. The stones go in the root as AB.
+
+	if len(args) < 1 {
+		return "", fmt.Errorf("syntax error")
+	}
+
+	n, err := strconv.Atoi(args[0])
+	if err != nil {
+		return "", fmt.Errorf("syntax error")
+	}
+
+	if s.Node.Parent != nil || len(s.Node.Children) > 0 || len(s.Node.Props["AB"]) + len(s.Node.Props["AW"]) > 0 {
+		return "", fmt.Errorf("board not empty")
+	}
+
+	sz := s.Node.Size()
+
+	points := k.HandicapPoints(sz, n)
+	if points == nil {
+		return "", fmt.Errorf("invalid number of stones")
+	}
+
+	props := map[string][]string{
+		"SZ": []string{fmt.Sprintf("%d", sz)},
+		"GM": []string{"1"},
+		"FF": []string{"4"},
+		"HA": []string{fmt.Sprintf("%d", n)},
+		"PL": []string{"W"},
+	}
+
+	var vertices []string
+
+	for _, p := range points {
+		props["AB"] = append(props["AB"], p.SGFString())
+		vertices = append(vertices, k.HumanStringFromPoint(p.X, p.Y, sz))
+	}
+
+	s.Node = k.NewNode(nil, props)
+	s.set_komi_property()
+
+	return strings.Join(vertices, " "), nil
+}
+
+
+func (self *Server) set_komi_property() {
+	self.Node.GetRoot().SetValue("KM", k.FormatReal(self.Komi))
+}
+
+
+func cmd_play(s *Server, args []string) (string, error) {
+
+	if len(args) < 2 {
+		return "", fmt.Errorf("syntax error")
+	}
+
+	colour, ok := ParseColour(args[0])
+	if ok == false {
+		return "", fmt.Errorf("syntax error")
+	}
+
+	sz := s.Node.Size()
+
+	x, y, pass, ok := ParseVertex(args[1], sz)
+	if ok == false {
+		return "", fmt.Errorf("syntax error")
+	}
+
+	return "", s.play(k.Move{OK: true, Pass: pass, Colour: colour, X: x, Y: y, Size: sz})
+}
+
+
+func (self *Server) play(mv k.Move) error {
+
+	// If the move is already in the tree, that node is reused.
+
+	before := len(self.Node.Children)
+
+	var node *k.Node
+
+	if mv.Pass {
+		node = self.Node.TryPass(mv.Colour)
+	} else {
+		var err error
+		node, err = self.Node.TryMove(mv.Colour, mv.X, mv.Y)
+		if err != nil {
+			return fmt.Errorf("illegal move")
+		}
+	}
+
+	if len(self.Node.Children) > before {
+		if self.created == nil {
+			self.created = make(map[*k.Node]bool)
+		}
+		self.created[node] = true
+	}
+
+	self.Node = node
+	return nil
+}
+
+
+func cmd_genmove(s *Server, args []string) (string, error) {
+
+	if len(args) < 1 {
+		return "", fmt.Errorf("syntax error")
+	}
+
+	colour, ok := ParseColour(args[0])
+	if ok == false {
+		return "", fmt.Errorf("syntax error")
+	}
+
+	mv, resign := s.Generator.GenMove(s.Node, colour)
+
+	if resign {
+		return "resign", nil
+	}
+
+	mv.OK = true
+	mv.Colour = colour
+	mv.Size = s.Node.Size()
+
+	err := s.play(mv)
+	if err != nil {
+		return "", fmt.Errorf("generator made an illegal move: %s", VertexString(mv))
+	}
+
+	return VertexString(mv), nil
+}
+
+
+func cmd_undo(s *Server, args []string) (string, error) {
+
+	// Undone moves are removed from the tree, if the server added them and
+	// nothing has been played after them. Anything else (e.g. a game from
+	// loadsgf) is left alone.
+
+	if s.Node.Parent == nil || s.Node.MoveInfo().OK == false {
+		return "", fmt.Errorf("cannot undo")
+	}
+
+	node := s.Node
+	s.Node = node.Parent
+
+	if s.created[node] && len(node.Children) == 0 {
+		s.Node.RemoveChild(node)
+		delete(s.created, node)
+	}
+
+	return "", nil
+}
+
+
+func cmd_showboard(s *Server, args []string) (string, error) {
+	return "\n" + strings.TrimRight(s.Node.DrawDiagram(k.DiagramOptions{Captures: true}), "\n"), nil
+}
+
+
+func cmd_final_score(s *Server, args []string) (string, error) {
+
+	// Area scoring, with every stone counted as alive.
+
+	return s.Node.AreaResult(s.Komi).String(), nil
+}
+
+
+func cmd_loadsgf(s *Server, args []string) (string, error) {
+
+	// loadsgf filename [move_number] - the position before move_number is
+	// played, following the main line; or the end of the main line.
+
+	if len(args) < 1 {
+		return "", fmt.Errorf("syntax error")
+	}
+
+	root, err := k.Load(args[0])
+	if err != nil {
+		return "", fmt.Errorf("cannot load file")
+	}
+
+	if root.Size() > 25 {
+		return "", fmt.Errorf("unacceptable size")
+	}
+
+	node := root.GetEnd()
+
+	if len(args) > 1 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil {
+			return "", fmt.Errorf("syntax error")
+		}
+		it := root.MainLine()
+		for node = it.Next(); node != nil; node = it.Next() {
+			if len(node.Children) == 0 || (node.Children[0].MoveInfo().OK && node.Children[0].MoveNumber() >= n) {
+				break
+			}
+		}
+	}
+
+	s.Node = node
+
+	if km, ok := root.GetValue("KM"); ok {
+		if komi, err := strconv.ParseFloat(km, 64); err == nil {
+			s.Komi = komi
+		}
+	}
+
+	return "", nil
+}
+
+
+func cmd_printsgf(s *Server, args []string) (string, error) {
+
+	// printsgf [filename] - with no filename, the SGF is the reply.
+
+	if len(args) > 0 {
+		err := s.Node.Save(args[0])
+		if err != nil {
+			return "", fmt.Errorf("cannot save file")
+		}
+		return "", nil
+	}
+
+	var b strings.Builder
+	s.Node.GetRoot().WriteTree(&b)
+	return strings.TrimRight(b.String(), "\n"), nil
+}
+
+// -------------------------------------------------------------------------
+
+func (self RandomGenerator) GenMove(node *k.Node, colour k.Colour) (k.Move, bool) {
+
+	sz := node.Size()
+
+	for _, i := range rand.Perm(sz * sz) {
+
+		x, y := i % sz, i / sz
+
+		if node.Board[x][y] != k.EMPTY || own_eye(node, colour, x, y) {
+			continue
+		}
+
+		// Only testing legality; the server plays the move itself, so remove
+		// the child TryMove() makes (if it made one)...
+
+		before := len(node.Children)
+
+		child, err := node.TryMove(colour, x, y)
+		if err != nil {
+			continue
+		}
+
+		if len(node.Children) > before {
+			node.RemoveChild(child)
+		}
+
+		return k.Move{OK: true, Colour: colour, X: x, Y: y, Size: sz}, false
+	}
+
+	return k.Move{OK: true, Pass: true, Colour: colour, Size: sz}, false
+}
+
+
+func own_eye(node *k.Node, colour k.Colour, x, y int) bool {
+
+	// Crudely: every neighbour is our own stone.
+
+	sz := node.Size()
+
+	for _, d := range [][2]int{{-1, 0}, {1, 0}, {0, -1}, {0, 1}} {
+		ax, ay := x + d[0], y + d[1]
+		if ax >= 0 && ax < sz && ay >= 0 && ay < sz && node.Board[ax][ay] != colour {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,106 @@
+package gtp
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func must(t *testing.T, s *Server, command string) string {
+	t.Helper()
+	reply, err := s.Command(command)
+	if err != nil {
+		t.Fatalf("%s: %v", command, err)
+	}
+	return reply
+}
+
+
+func TestServerPlayUndo(t *testing.T) {
+
+	s := NewServer(9)
+
+	must(t, s, "play B E5")
+	must(t, s, "play w c3")
+
+	if _, err := s.Command("play B E5"); err == nil {
+		t.Errorf("play on an occupied point succeeded")
+	}
+
+	if _, err := s.Command("play B J10"); err == nil {
+		t.Errorf("play off the board succeeded")
+	}
+
+	must(t, s, "undo")
+	must(t, s, "undo")
+
+	if s.Node.Parent != nil || len(s.Node.Children) != 0 {
+		t.Errorf("undo did not remove the moves it undid")
+	}
+
+	if _, err := s.Command("undo"); err == nil {
+		t.Errorf("undo at the root succeeded")
+	}
+}
+
+
+func TestServerLoadSGF(t *testing.T) {
+
+	// Undo within a loaded game must not cut it short.
+
+	filename := filepath.Join(t.TempDir(), "game.sgf")
+
+	err := ioutil.WriteFile(filename, []byte("(;GM[1]FF[4]SZ[9]KM[6.5];B[ee];W[cc];B[gg])"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewServer(19)
+
+	must(t, s, "loadsgf " + filename)
+
+	if s.Komi != 6.5 || s.Node.Size() != 9 || s.Node.MoveNumber() != 3 {
+		t.Fatalf("loadsgf gave komi %v, size %d, move %d", s.Komi, s.Node.Size(), s.Node.MoveNumber())
+	}
+
+	must(t, s, "undo")
+	must(t, s, "undo")
+
+	if len(s.Node.Children) != 1 || len(s.Node.Children[0].Children) != 1 {
+		t.Errorf("undo removed moves from the loaded game")
+	}
+
+	must(t, s, "loadsgf " + filename + " 2")
+
+	if s.Node.MoveNumber() != 1 {
+		t.Errorf("loadsgf with move 2 gave the position after move %d", s.Node.MoveNumber())
+	}
+
+	// A move the server adds to the loaded tree can be undone as usual...
+
+	must(t, s, "play W D4")
+	must(t, s, "undo")
+
+	if len(s.Node.Children) != 1 {
+		t.Errorf("node has %d children after play and undo, want 1", len(s.Node.Children))
+	}
+}
+
+
+func TestServerFinalScore(t *testing.T) {
+
+	s := NewServer(5)
+
+	must(t, s, "komi 0.5")
+	must(t, s, "play B C3")
+
+	if score := must(t, s, "final_score"); score != "B+24.5" {
+		t.Errorf("final_score gave %q, want %q", score, "B+24.5")
+	}
+
+	must(t, s, "play W B2")					// Now no empty point is territory.
+
+	if score := must(t, s, "final_score"); score != "W+0.5" {
+		t.Errorf("final_score gave %q, want %q", score, "W+0.5")
+	}
+}
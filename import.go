@@ -0,0 +1,136 @@
+package kikashi
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// -------------------------------------------------------------------------
+// Shared helpers for importing non-SGF game records.
+
+type IllegalMoves []error
+
+func (self IllegalMoves) Error() string {
+
+	// The importers return this alongside a usable tree: illegal moves are
+	// skipped, and play continues from the last legal position.
+
+	var lines []string
+	for _, err := range self {
+		lines = append(lines, err.Error())
+	}
+
+	return fmt.Sprintf("%d illegal move(s): %s", len(self), strings.Join(lines, "; "))
+}
+
+
+func HandicapPoints(size, handicap int) []Point {
+
+	// The standard fixed handicap placement (as GTP's fixed_handicap),
+	// or nil if it isn't defined for this size and number.
+
+	if handicap < 2 || handicap > 9 || size < 7 || size > 25 {
+		return nil
+	}
+
+	if size % 2 == 0 && handicap > 4 {
+		return nil
+	}
+
+	if size == 7 && handicap > 4 {
+		return nil
+	}
+
+	edge := 3
+	if size < 13 {
+		edge = 2
+	}
+
+	lo := edge
+	hi := size - 1 - edge
+	mid := size / 2
+
+	// In GTP order: D4 Q16 D16 Q4 ...
+
+	var points = []Point{{lo, hi}, {hi, lo}, {lo, lo}, {hi, hi}}
+
+	switch handicap {
+	case 2, 3, 4:
+		return points[:handicap]
+	case 5:
+		return append(points, Point{mid, mid})
+	case 6:
+		return append(points, Point{lo, mid}, Point{hi, mid})
+	case 7:
+		return append(points, Point{lo, mid}, Point{hi, mid}, Point{mid, mid})
+	case 8:
+		return append(points, Point{lo, mid}, Point{hi, mid}, Point{mid, lo}, Point{mid, hi})
+	default:
+		return append(points, Point{lo, mid}, Point{hi, mid}, Point{mid, lo}, Point{mid, hi}, Point{mid, mid})
+	}
+}
+
+
+func new_import_root(size, handicap int) *Node {
+
+	// A root for an imported game, with handicap stones if any.
+
+	props := map[string][]string{
+		"SZ": []string{fmt.Sprintf("%d", size)},
+		"GM": []string{"1"},
+		"FF": []string{"4"},
+	}
+
+	if handicap >= 2 {
+		props["HA"] = []string{fmt.Sprintf("%d", handicap)}
+		for _, p := range HandicapPoints(size, handicap) {
+			props["AB"] = append(props["AB"], p.SGFString())
+		}
+		props["PL"] = []string{"W"}
+	}
+
+	return NewNode(nil, props)
+}
+
+
+func play_imported_move(node *Node, colour Colour, x, y int, pass bool, number int, illegal *IllegalMoves) *Node {
+
+	// Play a move with TryMove(), recording (and skipping) illegal ones.
+
+	if pass {
+		return node.TryPass(colour)
+	}
+
+	new_node, err := node.TryMove(colour, x, y)
+
+	if err != nil {
+		*illegal = append(*illegal, fmt.Errorf("move %d (%s at %d,%d): %v", number, COLMAP[colour], x, y, err))
+		return node
+	}
+
+	return new_node
+}
+
+
+func loose_date(s string) (GameDate, bool) {
+
+	// For dates like "2016- 7-14-19-51-21" or "2016/07/14"; take the first three numbers.
+
+	var nums []int
+
+	for _, f := range strings.FieldsFunc(s, func(r rune) bool { return r < '0' || r > '9' }) {
+		n, err := strconv.Atoi(f)
+		if err != nil {
+			return GameDate{}, false
+		}
+		nums = append(nums, n)
+	}
+
+	if len(nums) < 3 {
+		return GameDate{}, false
+	}
+
+	d := GameDate{nums[0], nums[1], nums[2]}
+	return d, d.Valid()
+}
@@ -0,0 +1,173 @@
+package kikashi
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// -------------------------------------------------------------------------
+// JSON. The schema, for each node, is
+//
+//		{
+//			"props": {"B": ["dd"], "C": ["Hello"]},
+//			"board": ["..B..", ".W...", ...],
+//			"children": [ ...nodes... ]
+//		}
+//
+// Property values are decoded as GetValue() returns them (no SGF escapes).
+// Keys are written sorted. "board" is optional, one string per row from the
+// top, using "." "B" and "W"; it is ignored when decoding, since boards are
+// always rebuilt from the properties. "children" is omitted if empty.
+
+type json_node struct {
+	Props			map[string][]string		`json:"props"`
+	Board			[]string				`json:"board,omitempty"`
+	Children		[]*json_node			`json:"children,omitempty"`
+}
+
+
+func (self *Node) EncodeJSON(with_boards bool) ([]byte, error) {
+
+	// Encode this node and everything below it. A non-root node is encoded
+	// as ExtractSubtree() would make it: a root whose setup stones give this
+	// node's position, so that the decoded tree has the same boards.
+
+	if self.Parent != nil {
+		return self.ExtractSubtree().EncodeJSON(with_boards)
+	}
+
+	converted := make(map[*Node]*json_node)
+
+	self.WalkDepthFirst(func(node *Node, depth int) WalkAction {
+
+		j := &json_node{Props: make(map[string][]string)}
+
+		for key := range node.Props {
+			j.Props[key] = node.AllValues(key)
+		}
+
+		if with_boards {
+			j.Board = board_rows(node.Board)
+		}
+
+		if depth > 0 {
+			parent := converted[node.Parent]
+			parent.Children = append(parent.Children, j)
+		}
+
+		converted[node] = j
+		return WALK_CONTINUE
+
+	}, nil)
+
+	return json.Marshal(converted[self])
+}
+
+
+func DecodeJSON(data []byte) (*Node, error) {
+
+	// The inverse of EncodeJSON(). Returns a new root with boards built.
+	// Values are stored as given, duplicates included, so that a round trip
+	// doesn't change the tree.
+
+	var top json_node
+
+	err := json.Unmarshal(data, &top)
+	if err != nil {
+		return nil, err
+	}
+
+	type pair struct {
+		j				*json_node
+		parent			*Node
+	}
+
+	var root *Node
+	stack := []pair{{&top, nil}}
+
+	for len(stack) > 0 {
+
+		item := stack[len(stack) - 1]
+		stack = stack[:len(stack) - 1]
+
+		if item.j == nil {
+			return nil, fmt.Errorf("DecodeJSON(): null node")
+		}
+
+		node := new_bare_node(item.parent)
+
+		for _, key := range sorted_keys(item.j.Props) {
+			if key == "" {
+				return nil, fmt.Errorf("DecodeJSON(): bad key %q", key)
+			}
+			for _, value := range item.j.Props[key] {
+				node.append_raw_value(key, encode_value(key, value))
+			}
+		}
+
+		if root == nil {
+			root = node
+		}
+
+		for i := len(item.j.Children) - 1; i >= 0; i-- {		// Reversed, so children are created in order.
+			stack = append(stack, pair{item.j.Children[i], node})
+		}
+	}
+
+	root.make_board_recursive()
+	return root, nil
+}
+
+
+func (self *Node) MarshalJSON() ([]byte, error) {
+
+	// For encoding/json. Boards are not included; use EncodeJSON() for those.
+
+	return self.EncodeJSON(false)
+}
+
+
+func (self *Node) UnmarshalJSON(data []byte) error {
+
+	// For encoding/json. The node becomes the root of the decoded tree.
+
+	root, err := DecodeJSON(data)
+	if err != nil {
+		return err
+	}
+
+	*self = *root
+
+	for _, child := range self.Children {
+		child.Parent = self
+	}
+
+	return nil
+}
+
+
+func board_rows(board [][]Colour) []string {
+
+	// Board is indexed [x][y]; rows are y.
+
+	if len(board) == 0 {
+		return nil
+	}
+
+	var rows []string
+
+	for y := 0; y < len(board[0]); y++ {
+		var b strings.Builder
+		for x := 0; x < len(board); x++ {
+			switch board[x][y] {
+			case BLACK: b.WriteByte('B')
+			case WHITE: b.WriteByte('W')
+			default: b.WriteByte('.')
+			}
+		}
+		rows = append(rows, b.String())
+	}
+
+	return rows
+}
@@ -0,0 +1,209 @@
+package kikashi
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// -------------------------------------------------------------------------
+// Kifu figures: the printed form of a game record. Each figure starts from
+// the position before its first move, and shows every move in it as a
+// numbered stone, even if it was later captured. A move on a point already
+// used in the figure gets a note such as "12 at 7" instead; if the point
+// holds a stone from before the figure, that stone is given a letter, as in
+// "14 at A".
+
+type Figure struct {
+	Number			int				// 1 for the first figure, and so on.
+	First			int				// The move numbers shown in this figure.
+	Last			int
+	FirstColour		Colour			// The colour of move First.
+	Notes			[]string		// "12 at 7", "20: pass"...
+	scene			*render_scene
+}
+
+
+func (self *Node) Figures(end *Node, moves_per_figure int) ([]*Figure, error) {
+
+	// Figures for the moves after this node, up to and including end, which
+	// must be a descendant. If end is nil, the main line is followed to its
+	// end. If moves_per_figure is 0, there is only one figure.
+
+	var nodes []*Node
+
+	if end == nil {
+		it := self.MainLine()
+		it.Next()							// Skip self
+		for node := it.Next(); node != nil; node = it.Next() {
+			nodes = append(nodes, node)
+		}
+	} else {
+		node := end
+		for ; node != nil && node != self; node = node.Parent {
+			nodes = append([]*Node{node}, nodes...)
+		}
+		if node == nil {
+			return nil, fmt.Errorf("Figures(): end is not a descendant of the start node")
+		}
+	}
+
+	var figures []*Figure
+	var fig *Figure
+	var letters int
+
+	n := self.MoveNumber()
+
+	for _, node := range nodes {
+
+		mv := node.MoveInfo()
+		if mv.OK == false {
+			continue
+		}
+
+		n++
+
+		if fig == nil || (moves_per_figure > 0 && fig.Last - fig.First + 1 >= moves_per_figure) {
+
+			fig = &Figure{
+				Number: len(figures) + 1,
+				First: n,
+				FirstColour: mv.Colour,
+				scene: &render_scene{
+					size: node.Size(),
+					board: copy_board(node.Parent.Board),
+					markup: make(map[Point]string),
+					labels: make(map[Point]string),
+					numbers: make(map[Point]int),
+					last: Point{-1, -1},
+				},
+			}
+
+			figures = append(figures, fig)
+			letters = 0
+		}
+
+		fig.Last = n
+		scene := fig.scene
+
+		if mv.Pass {
+			fig.Notes = append(fig.Notes, fmt.Sprintf("%d: pass", n))
+			continue
+		}
+
+		p := Point{mv.X, mv.Y}
+
+		if number, ok := scene.numbers[p]; ok {
+			fig.Notes = append(fig.Notes, fmt.Sprintf("%d at %d", n, number))
+		} else if scene.board[mv.X][mv.Y] != EMPTY {
+			if _, ok := scene.labels[p]; ok == false {
+				scene.labels[p] = strings.ToUpper(label_letters(letters))
+				letters++
+			}
+			fig.Notes = append(fig.Notes, fmt.Sprintf("%d at %s", n, scene.labels[p]))
+		} else {
+			scene.board[mv.X][mv.Y] = mv.Colour
+			scene.numbers[p] = n
+		}
+	}
+
+	return figures, nil
+}
+
+
+func (self *Figure) Title() string {
+	return fmt.Sprintf("Figure %d (%d-%d)", self.Number, self.First, self.Last)
+}
+
+
+func (self *Figure) Text() string {
+
+	// The figure as text: a title, then the board with each point as wide
+	// as the largest move number, then the notes.
+
+	sz := self.scene.size
+	width := len(fmt.Sprintf("%d", self.Last)) + 1
+
+	stars := make(map[Point]bool)
+	for _, p := range star_points(sz) {
+		stars[p] = true
+	}
+
+	letters := "ABCDEFGHJKLMNOPQRSTUVWXYZ"
+	if sz > len(letters) {
+		letters = ALPHA
+	}
+
+	margin := len(fmt.Sprintf("%d", sz))
+
+	var lines []string
+
+	lines = append(lines, fmt.Sprintf("%s - %s first", self.Title(), self.FirstColour.Name()))
+
+	header := strings.Repeat(" ", margin)
+	for x := 0; x < sz; x++ {
+		header += fmt.Sprintf("%*s", width, letters[x:x + 1])
+	}
+	lines = append(lines, header)
+
+	for y := 0; y < sz; y++ {
+
+		line := fmt.Sprintf("%*d", margin, sz - y)
+
+		for x := 0; x < sz; x++ {
+
+			p := Point{x, y}
+			s := "."
+
+			if n, ok := self.scene.numbers[p]; ok {
+				s = fmt.Sprintf("%d", n)
+			} else if label, ok := self.scene.labels[p]; ok {
+				s = label
+			} else if self.scene.board[x][y] == BLACK {
+				s = "X"
+			} else if self.scene.board[x][y] == WHITE {
+				s = "O"
+			} else if stars[p] {
+				s = ","
+			}
+
+			line += fmt.Sprintf("%*s", width, s)
+		}
+
+		lines = append(lines, line)
+	}
+
+	lines = append(lines, self.Notes...)
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+
+func (self *Figure) SaveSVG(filename string, opts RenderOptions) error {
+
+	outfile, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer outfile.Close()
+
+	w := bufio.NewWriter(outfile)
+	defer w.Flush()
+
+	return self.WriteSVG(w, opts)
+}
+
+
+func (self *Figure) WriteSVG(outfile io.Writer, opts RenderOptions) error {
+
+	// One page: the board, with the title and notes underneath.
+
+	opts = opts.with_defaults()
+
+	scene := *self.scene
+	scene.caption = append([]string{self.Title()}, self.Notes...)
+
+	return scene.write_svg(outfile, opts)
+}
@@ -6,6 +6,7 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -49,6 +50,18 @@ func (c Colour) Opposite() Colour {
 	}
 }
 
+
+func (self Colour) Name() string {
+
+	// For text meant for people, e.g. "Black wins".
+
+	switch self {
+	case BLACK: return "Black"
+	case WHITE: return "White"
+	default: return "Nobody"
+	}
+}
+
 // -------------------------------------------------------------------------
 
 type Move struct {
@@ -86,6 +99,24 @@ type Node struct {
 	Parent			*Node
 	Board			[][]Colour		// Created immediately by NewNode().
 	SZ_cache		int				// Cached value. 0 means not cached yet.
+	last_visited	*Node			// The child we were most recently in, if any. See Forward().
+	key_order		[]string		// Order keys were first added, for writing. See ordered_keys().
+	layout			*node_layout	// How the node was written, if loaded verbatim. See write_node().
+}
+
+type node_layout struct {			// Everything needed to write a node back byte-for-byte.
+	opened			bool			// Whether a "(" came before the node.
+	open			string			// The bytes before that "(".
+	semicolon		string			// The bytes before the ";".
+	props			[]layout_prop	// Each value, in file order.
+	close			string			// The bytes before the ")" ending the node's sequence, if any.
+	head			string			// Root only: the bytes before the game tree...
+	tail			string			// ...and after it.
+}
+
+type layout_prop struct {
+	prefix			string			// All the bytes between the last token and the "[", including the key.
+	key				string
 }
 
 
@@ -95,7 +126,7 @@ func NewNode(parent *Node, props map[string][]string) *Node {
 	node.Parent = parent
 	node.Props = make(map[string][]string)
 
-	for key, _ := range props {
+	for _, key := range sorted_keys(props) {			// Key order is kept when saving, so don't use map order.
 		for _, s := range props[key] {
 			node.add_value(key, s)
 		}
@@ -130,8 +161,8 @@ func NewTree(size int) *Node {
 
 func new_bare_node(parent *Node) *Node {
 
-	// Doesn't accept properties or make a board.
-	// Used only for file loading.
+	// Doesn't accept properties or make a board; the caller fills those in.
+	// Used when building trees from files, JSON, copies and merges.
 
 	node := new(Node)
 	node.Parent = parent
@@ -160,8 +191,11 @@ func (self *Node) AddValue(key, value string) {
 
 
 func (self *Node) add_value(key, value string) {			// Handles escaping; no other function should
+	self.add_raw_value(key, encode_value(key, value))
+}
+
 
-	value = escape_string(value)
+func (self *Node) add_raw_value(key, value string) {		// Value must already be in SGF (escaped) form
 
 	for i := 0; i < len(self.Props[key]); i++ {				// Ignore if the value already exists
 		if self.Props[key][i] == value {
@@ -169,10 +203,84 @@ func (self *Node) add_value(key, value string) {			// Handles escaping; no other
 		}
 	}
 
+	self.append_raw_value(key, value)
+}
+
+
+func (self *Node) append_raw_value(key, value string) {	// As add_raw_value() but allows duplicates
+
+	if _, ok := self.Props[key]; ok == false {
+		if string_in_slice(key, self.key_order) == false {
+			self.key_order = append(self.key_order, key)
+		}
+	}
+
 	self.Props[key] = append(self.Props[key], value)
 }
 
 
+func (self *Node) delete_key(key string) {
+
+	// Unlike DeleteKey(), this works on board-altering properties too.
+
+	delete(self.Props, key)
+
+	for i := len(self.key_order) - 1; i >= 0; i-- {
+		if self.key_order[i] == key {
+			self.key_order = append(self.key_order[:i], self.key_order[i + 1:]...)
+		}
+	}
+}
+
+
+func string_in_slice(s string, list []string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+
+func (self *Node) ordered_keys() []string {
+
+	// Keys in the order they were added (which, for loaded files, is file
+	// order), followed by any keys added directly to Props, sorted.
+
+	var ret []string
+	seen := make(map[string]bool)
+
+	for _, key := range self.key_order {
+		if _, ok := self.Props[key]; ok && seen[key] == false {
+			ret = append(ret, key)
+			seen[key] = true
+		}
+	}
+
+	var rest []string
+
+	for key, _ := range self.Props {
+		if seen[key] == false {
+			rest = append(rest, key)
+		}
+	}
+
+	sort.Strings(rest)
+	return append(ret, rest...)
+}
+
+
+func sorted_keys(props map[string][]string) []string {
+	var keys []string
+	for key, _ := range props {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+
 func (self *Node) SetValue(key, value string) {
 
 	// Disallow keys that change the board...
@@ -198,7 +306,7 @@ func (self *Node) GetValue(key string) (value string, ok bool) {
 		return "", false
 	}
 
-	return unescape_string(list[0]), true
+	return decode_value(key, list[0]), true
 }
 
 
@@ -215,7 +323,7 @@ func (self *Node) AllValues(key string) []string {
 	var ret []string		// Make a new slice to avoid aliasing.
 
 	for _, s := range list {
-		ret = append(ret, unescape_string(s))
+		ret = append(ret, decode_value(key, s))
 	}
 
 	return ret
@@ -233,14 +341,14 @@ func (self *Node) DeleteValue(key, value string) {
 	}
 
 	for i := len(self.Props[key]) - 1; i >= 0; i-- {
-		v := self.Props[key][i]
+		v := decode_value(key, self.Props[key][i])
 		if v == value {
 			self.Props[key] = append(self.Props[key][:i], self.Props[key][i+1:]...)
 		}
 	}
 
 	if len(self.Props[key]) == 0 {
-		delete(self.Props, key)
+		self.delete_key(key)
 	}
 }
 
@@ -255,7 +363,7 @@ func (self *Node) DeleteKey(key string) {
 		}
 	}
 
-	delete(self.Props, key)
+	self.delete_key(key)
 }
 
 
@@ -335,7 +443,9 @@ func (self *Node) Size() int {
 
 			if self.SZ_cache == 0 {
 				self.SZ_cache = DEFAULT_SIZE
-				self.SetValue("SZ", fmt.Sprintf("%d", DEFAULT_SIZE))			// Set the actual property in the root.
+				if self.layout == nil {											// Verbatim trees are left as they were.
+					self.SetValue("SZ", fmt.Sprintf("%d", DEFAULT_SIZE))		// Set the actual property in the root.
+				}
 			}
 
 		} else {
@@ -352,12 +462,18 @@ func (self *Node) Size() int {
 func (self *Node) NextColour() Colour {
 
 	// What colour a new move made from this node should be.
-	// (i.e. the colour of a child's move.)
+	// (i.e. the colour of a child's move.) A move in the node itself wins,
+	// but after that PL is honoured: it is the only record of whose turn it
+	// is in a setup position, e.g. a root made by ExtractSubtree().
 
 	if len(self.Props["B"]) > 0 && len(self.Props["W"]) == 0 {
 		return WHITE
 	} else if len(self.Props["W"]) > 0 && len(self.Props["B"]) == 0 {
 		return BLACK
+	} else if pl, _ := self.GetValue("PL"); pl == "B" {
+		return BLACK
+	} else if pl == "W" {
+		return WHITE
 	} else if len(self.Props["AB"]) > 0 && len(self.Props["AW"]) == 0 {
 		return WHITE
 	} else if len(self.Props["AW"]) > 0 && len(self.Props["AB"]) == 0 {
@@ -375,8 +491,9 @@ func (self *Node) make_board() {
 	sz := self.Size()
 
 	self.Board = make([][]Colour, sz)
+	backing := make([]Colour, sz * sz)				// One allocation for all columns.
 	for x := 0; x < len(self.Board); x++ {
-		self.Board[x] = make([]Colour, sz)
+		self.Board[x] = backing[x * sz : (x + 1) * sz]
 	}
 
 	if self.Parent != nil {
@@ -389,19 +506,18 @@ func (self *Node) make_board() {
 
 	// Now fix the board using the properties...
 
-	for _, foo := range self.Props["AB"] {
-		x, y, ok := PointFromSGFString(foo, sz)
-		if ok { self.Board[x][y] = BLACK }
+	// Setup properties may use compressed point lists, e.g. AB[aa:cc]
+
+	for _, p := range points_from_list(self.Props["AB"], sz) {
+		self.Board[p.X][p.Y] = BLACK
 	}
 
-	for _, foo := range self.Props["AW"] {
-		x, y, ok := PointFromSGFString(foo, sz)
-		if ok { self.Board[x][y] = WHITE }
+	for _, p := range points_from_list(self.Props["AW"], sz) {
+		self.Board[p.X][p.Y] = WHITE
 	}
 
-	for _, foo := range self.Props["AE"] {
-		x, y, ok := PointFromSGFString(foo, sz)
-		if ok { self.Board[x][y] = EMPTY }
+	for _, p := range points_from_list(self.Props["AE"], sz) {
+		self.Board[p.X][p.Y] = EMPTY
 	}
 
 	// Play move: B / W
@@ -423,10 +539,10 @@ func (self *Node) make_board_recursive() {
 	// Normally, new nodes have their board made instantly,
 	// but not when loading a file, hence the need for this.
 
-	self.make_board()
-	for _, child := range self.Children {
-		child.make_board_recursive()
-	}
+	self.WalkDepthFirst(func(node *Node, depth int) WalkAction {
+		node.make_board()
+		return WALK_CONTINUE
+	}, nil)
 }
 
 
@@ -540,6 +656,7 @@ func (self *Node) TryMove(colour Colour, x, y int) (*Node, error) {
 
 	for _, child := range self.Children {
 		if child.MoveInfo() == mv {
+			self.last_visited = child
 			return child, nil
 		}
 	}
@@ -561,6 +678,7 @@ func (self *Node) TryMove(colour Colour, x, y int) (*Node, error) {
 		return self, fmt.Errorf("TryMove(): Suicide")
 	}
 
+	self.last_visited = new_node
 	return new_node, nil
 }
 
@@ -574,12 +692,14 @@ func (self *Node) TryPass(colour Colour) *Node {
 	for _, child := range self.Children {
 		mi := child.MoveInfo()
 		if mi.OK && mi.Pass && mi.Colour == colour {
+			self.last_visited = child
 			return child
 		}
 	}
 
 	key := "B" ; if colour == WHITE { key = "W" }
 	new_node := NewNode(self, map[string][]string{key: []string{""}})
+	self.last_visited = new_node
 	return new_node
 }
 
@@ -595,6 +715,10 @@ func (self *Node) RemoveChild(child *Node) {
 			self.Children = append(self.Children[:i], self.Children[i+1:]...)
 		}
 	}
+
+	if self.last_visited == child {
+		self.last_visited = nil
+	}
 }
 
 
@@ -661,46 +785,153 @@ func (self *Node) Save(filename string) error {
 
 func (self *Node) WriteTree(outfile io.Writer) {		// Relies on values already being correctly backslash-escaped
 
-	node := self
+	// Iterative, with an explicit stack, so deep trees are fine. An item with
+	// close set means "close the variation that ends at this node".
 
-	fmt.Fprintf(outfile, "(")
+	type item struct {
+		node		*Node
+		close		bool
+	}
 
-	for {
+	if self.Parent == nil && self.layout != nil {
+		io.WriteString(outfile, self.layout.head)
+	}
 
-		fmt.Fprintf(outfile, ";")
+	stack := []item{{self, false}}
 
-		for key, _ := range node.Props {
+	for len(stack) > 0 {
 
-			fmt.Fprintf(outfile, "%s", key)
+		it := stack[len(stack) - 1]
+		stack = stack[:len(stack) - 1]
 
-			for _, value := range node.Props[key] {
-				fmt.Fprintf(outfile, "[%s]", value)
-			}
+		node := it.node
+
+		if it.close {
+			node.write_close(outfile)
+			continue
+		}
+
+		if node.layout != nil {
+			io.WriteString(outfile, node.layout.open)
 		}
 
-		if len(node.Children) > 1 {
+		io.WriteString(outfile, "(")
+
+		for {
+
+			node.write_node(outfile)
+
+			if len(node.Children) == 1 && node.Children[0].opens_variation() == false {
+
+				node = node.Children[0]
+				continue
+
+			} else if len(node.Children) > 0 {
+
+				stack = append(stack, item{node, true})
+
+				for i := len(node.Children) - 1; i >= 0; i-- {
+					stack = append(stack, item{node.Children[i], false})
+				}
+
+				break
+
+			} else {
+
+				node.write_close(outfile)
+				break
 
-			for _, child := range node.Children {
-				child.WriteTree(outfile)
 			}
+		}
+	}
 
-			break
+	if self.Parent == nil && self.layout != nil {
+		io.WriteString(outfile, self.layout.tail)
+	}
+}
 
-		} else if len(node.Children) == 1 {
 
-			node = node.Children[0]
-			continue
+func (self *Node) write_node(outfile io.Writer) {
 
-		} else {
+	// A node loaded verbatim is written exactly as it was read - whitespace,
+	// repeated keys and all - unless its properties have changed since, in
+	// which case it is written normally.
 
-			break
+	if self.layout != nil {
+		io.WriteString(outfile, self.layout.semicolon)
+	}
+
+	io.WriteString(outfile, ";")
+
+	if self.layout != nil && self.layout.matches(self.Props) {
 
+		next := make(map[string]int)
+
+		for _, lp := range self.layout.props {
+			io.WriteString(outfile, lp.prefix)
+			io.WriteString(outfile, "[")
+			io.WriteString(outfile, self.Props[lp.key][next[lp.key]])
+			io.WriteString(outfile, "]")
+			next[lp.key]++
 		}
 
+		return
+	}
+
+	for _, key := range self.ordered_keys() {
+
+		io.WriteString(outfile, key)
+
+		for _, value := range self.Props[key] {
+			io.WriteString(outfile, "[")
+			io.WriteString(outfile, value)
+			io.WriteString(outfile, "]")
+		}
+	}
+}
+
+
+func (self *Node) write_close(outfile io.Writer) {
+	if self.layout != nil {
+		io.WriteString(outfile, self.layout.close)
+		io.WriteString(outfile, ")")
+	} else {
+		io.WriteString(outfile, ")\n")
+	}
+}
+
+
+func (self *Node) opens_variation() bool {
+
+	// Whether a node loaded verbatim was written as "(;..." even though it
+	// is an only child, e.g. the B node in (;GM[1](;B[dd])).
+
+	return self.layout != nil && self.layout.opened
+}
+
+
+func (self *node_layout) matches(props map[string][]string) bool {
+
+	// Whether the layout still has exactly the keys and number of values
+	// of the node's properties. (Values changed in place don't matter.)
+
+	counts := make(map[string]int)
+
+	for _, lp := range self.props {
+		counts[lp.key]++
+	}
+
+	if len(counts) != len(props) {
+		return false
 	}
 
-	fmt.Fprintf(outfile, ")\n")
-	return
+	for key, n := range counts {
+		if len(props[key]) != n {
+			return false
+		}
+	}
+
+	return true
 }
 
 
@@ -712,18 +943,14 @@ func (self *Node) StepGTP() []string {
 
 	sz := self.Size()
 
-	for _, foo := range self.Props["AB"] {
-		x, y, ok := PointFromSGFString(foo, sz)
-		if ok {
-			commands = append(commands, fmt.Sprintf("play B %v", HumanStringFromPoint(x, y, sz)))
-		}
+	// Setup properties may use compressed point lists, e.g. AB[aa:cc]
+
+	for _, p := range points_from_list(self.Props["AB"], sz) {
+		commands = append(commands, fmt.Sprintf("play B %v", HumanStringFromPoint(p.X, p.Y, sz)))
 	}
 
-	for _, foo := range self.Props["AW"] {
-		x, y, ok := PointFromSGFString(foo, sz)
-		if ok {
-			commands = append(commands, fmt.Sprintf("play W %v", HumanStringFromPoint(x, y, sz)))
-		}
+	for _, p := range points_from_list(self.Props["AW"], sz) {
+		commands = append(commands, fmt.Sprintf("play W %v", HumanStringFromPoint(p.X, p.Y, sz)))
 	}
 
 	for _, foo := range self.Props["B"] {
@@ -783,6 +1010,24 @@ func (self *Node) FullGTP() []string {
 // -------------------------------------------------------------------------
 
 func Load(filename string) (*Node, error) {
+	return load_file(filename, false)
+}
+
+
+func LoadVerbatim(filename string) (*Node, error) {
+
+	// Load without canonicalising anything, so that Save() writes the file
+	// back byte-for-byte: every property (including private ones), value,
+	// duplicate and repeated key, in order, with the whitespace between them
+	// and anything before or after the game tree. Nodes whose properties
+	// are changed are written normally. Note that FF[3] style keys such as
+	// "AddBlack" are not understood as board-altering properties.
+
+	return load_file(filename, true)
+}
+
+
+func load_file(filename string, verbatim bool) (*Node, error) {
 
 	sgf_bytes, err := ioutil.ReadFile(filename)
 
@@ -790,7 +1035,7 @@ func Load(filename string) (*Node, error) {
 		return nil, err
 	}
 
-	root, err := load_sgf(string(sgf_bytes))
+	root, err := load_sgf(string(sgf_bytes), verbatim)
 
 	if err != nil {
 		return nil, err
@@ -803,107 +1048,173 @@ func Load(filename string) (*Node, error) {
 }
 
 
-func load_sgf_tree(sgf string, parent_of_local_root *Node) (*Node, int, error) {
+func load_sgf(sgf string, verbatim bool) (*Node, error) {
 
-	// FIXME: this is not unicode aware. Potential problems exist
-	// if a unicode code point contains a meaningful character.
+	if verbatim {
+		return load_sgf_verbatim(sgf)
+	}
+
+	sgf = strings.TrimSpace(sgf)
+
+	if len(sgf) == 0 {
+		return nil, fmt.Errorf("load_sgf: empty input")
+	}
+
+	if sgf[0] != '(' {				// Tolerate a missing leading "("
+		sgf = "(" + sgf
+	}
+
+	root, _, err := parse_sgf_tree([]byte(sgf), verbatim)
+	return root, err
+}
+
+
+func load_sgf_verbatim(sgf string) (*Node, error) {
+
+	// As load_sgf(), but the bytes around the game tree are kept in the root.
+	// These include any further games, in the case of a collection.
+
+	start := strings.IndexByte(sgf, '(')
+
+	if strings.TrimSpace(sgf) == "" || start == -1 {
+		return nil, fmt.Errorf("load_sgf: no game tree found")
+	}
+
+	root, n, err := parse_sgf_tree([]byte(sgf[start:]), true)
+	if err != nil {
+		return nil, err
+	}
+
+	root.layout.head = sgf[:start]
+	root.layout.tail = sgf[start + n:]
+
+	return root, nil
+}
+
+
+func parse_sgf_tree(sgf []byte, verbatim bool) (*Node, int, error) {
+
+	// Parses the first game tree in the input, which should start with "(".
+	// Returns the root (without boards) and the number of bytes consumed.
+	//
+	// Normally, lowercase letters in keys are dropped (so FF[3] "AddBlack"
+	// becomes "AB") and duplicate values are ignored. If verbatim is set, keys
+	// are kept exactly as written and every value is kept, and each node gets
+	// a layout recording the bytes between the tokens, so that saving the
+	// tree reproduces the input exactly.
+	//
+	// This uses an explicit stack of open variations rather than recursion,
+	// so arbitrarily deep trees are fine. Working on bytes is safe for UTF-8,
+	// since all the special characters are ASCII.
 
 	var root *Node
 	var node *Node
+	var stack []*Node				// For each open "(", the node it branches from.
 
 	var inside bool
-	var value string
-	var key string
+	var value []byte
+	var key []byte
 	var keycomplete bool
-	var chars_to_skip int
 
-	var err error
+	var gap_start int				// Verbatim only: where the bytes since the last token began.
+	var prefix string
+	var opened bool
+	var open string
 
 	for i := 0; i < len(sgf); i++ {
 
 		c := sgf[i]
 
-		if chars_to_skip > 0 {
-			chars_to_skip--
-			continue
-		}
-
 		if inside {
 
 			if c == '\\' {
 				if len(sgf) <= i + 1 {
-					return nil, 0, fmt.Errorf("load_sgf_tree: escape character at end of input")
+					return nil, 0, fmt.Errorf("parse_sgf_tree: escape character at end of input")
 				}
-				value += string('\\')
-				value += string([]byte{sgf[i + 1]})
-				chars_to_skip = 1
+				value = append(value, '\\', sgf[i + 1])		// Stored as-is, escapes included.
+				i++
 			} else if c == ']' {
 				inside = false
 				if node == nil {
-					return nil, 0, fmt.Errorf("load_sgf_tree: node == nil after: else if c == ']'")
+					return nil, 0, fmt.Errorf("parse_sgf_tree: value outside of any node")
+				}
+				if verbatim {
+					node.append_raw_value(string(key), string(value))
+					node.layout.props = append(node.layout.props, layout_prop{prefix: prefix, key: string(key)})
+					gap_start = i + 1
+				} else {
+					node.add_raw_value(string(key), string(value))
 				}
-				node.add_value(key, value)
 			} else {
-				value += string([]byte{c})
+				value = append(value, c)
 			}
 
 		} else {
 
 			if c == '[' {
-				value = ""
+				value = value[:0]
 				inside = true
 				keycomplete = true
+				if verbatim {
+					prefix = string(sgf[gap_start:i])
+				}
 			} else if c == '(' {
-				if node == nil {
-					return nil, 0, fmt.Errorf("load_sgf_tree: node == nil after: else if c == '('")
+				if node == nil && len(stack) > 0 {
+					return nil, 0, fmt.Errorf("parse_sgf_tree: variation without a parent node")
 				}
-				_, chars_to_skip, err = load_sgf_tree(sgf[i + 1:], node)
-				if err != nil {
-					return nil, 0, err
+				stack = append(stack, node)
+				if verbatim {
+					opened = true
+					open = string(sgf[gap_start:i])
+					gap_start = i + 1
 				}
 			} else if c == ')' {
-				if root == nil {
-					return nil, 0, fmt.Errorf("load_sgf_tree: root == nil after: else if c == ')'")
+				if len(stack) == 0 {
+					return nil, 0, fmt.Errorf("parse_sgf_tree: unbalanced ')'")
+				}
+				if node == stack[len(stack) - 1] {
+					return nil, 0, fmt.Errorf("parse_sgf_tree: empty variation")
+				}
+				if verbatim {
+					node.layout.close = string(sgf[gap_start:i])
+					gap_start = i + 1
+				}
+				node = stack[len(stack) - 1]
+				stack = stack[:len(stack) - 1]
+				if len(stack) == 0 {
+					return root, i + 1, nil					// Return bytes read.
 				}
-				return root, i + 1, nil		// Return characters read.
 			} else if c == ';' {
-				if node == nil {
-					newnode := new_bare_node(parent_of_local_root)
-					root = newnode
-					node = newnode
-				} else {
-					newnode := new_bare_node(node)
-					node = newnode
+				if len(stack) == 0 {
+					return nil, 0, fmt.Errorf("parse_sgf_tree: node outside of any game tree")
+				}
+				node = new_bare_node(node)
+				if root == nil {
+					root = node
+				}
+				if verbatim {
+					node.layout = &node_layout{opened: opened, open: open, semicolon: string(sgf[gap_start:i])}
+					gap_start = i + 1
+					opened = false
+					open = ""
 				}
 			} else {
-				if c >= 'A' && c <= 'Z' {
+				if (c >= 'A' && c <= 'Z') || (verbatim && c >= 'a' && c <= 'z') {
 					if keycomplete {
-						key = ""
+						key = key[:0]
 						keycomplete = false
 					}
-					key += string([]byte{c})
+					key = append(key, c)
 				}
 			}
 		}
 	}
 
 	if root == nil {
-		return nil, 0, fmt.Errorf("load_sgf_tree: root == nil at function end")
-	}
-
-	return root, len(sgf), nil		// Return characters read.
-}
-
-
-func load_sgf(sgf string) (*Node, error) {
-
-	sgf = strings.TrimSpace(sgf)
-	if sgf[0] == '(' {				// the load_sgf_tree() function assumes the
-		sgf = sgf[1:]				// leading "(" has already been discarded.
+		return nil, 0, fmt.Errorf("parse_sgf_tree: no nodes found")
 	}
 
-	root, _, err := load_sgf_tree(sgf, nil)
-	return root, err
+	return root, len(sgf), nil		// Unterminated, but accept what we have.
 }
 
 // -------------------------------------------------------------------------
@@ -993,14 +1304,15 @@ func adjacent_points(x, y, size int) []Point {
 }
 
 
-func escape_string(s string) string {
+func escape_string(s string, escape_colons bool) string {
 
-	// Treating the input as a byte sequence, not a sequence of code points. Meh.
+	// Treating the input as a byte sequence, not a sequence of code points.
+	// This is safe for UTF-8 since the special characters are all ASCII.
 
 	var new_s []byte
 
 	for n := 0; n < len(s); n++ {
-		if s[n] == '\\' || s[n] == ']' {
+		if s[n] == '\\' || s[n] == ']' || (escape_colons && s[n] == ':') {
 			new_s = append(new_s, '\\')
 		}
 		new_s = append(new_s, s[n])
@@ -1012,8 +1324,8 @@ func escape_string(s string) string {
 
 func unescape_string(s string) string {
 
-	// Treating the input as a byte sequence, not a sequence of code points. Meh.
-	// Some issues with unicode.
+	// Treating the input as a byte sequence, not a sequence of code points.
+	// Used for values with no text semantics; see decode_value().
 
 	var new_s []byte
 
@@ -0,0 +1,244 @@
+package kikashi
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// -------------------------------------------------------------------------
+// Benchmarks for loading and writing. The inputs are generated: "wide" is a
+// few MB of game with many short, commented variations; "deep" is 100,000
+// variations each nested inside the last, which would exhaust the stack of
+// a recursive parser or writer.
+
+const BENCH_DEEP = 100000
+
+type bench_input struct {
+	name			string
+	sgf				string
+}
+
+
+func bench_point(i int) string {
+	return SGFStringFromPoint(i % 19, (i / 19) % 19)
+}
+
+
+func bench_colour(i int) string {
+	if i % 2 == 0 {
+		return "B"
+	}
+	return "W"
+}
+
+
+func wide_sgf() string {
+
+	// A 200 move main line, with 20 variations of 5 moves at every move.
+
+	comment := strings.Repeat("A comment about this move, with some \\] escapes in it. ", 3)
+
+	var sb strings.Builder
+	sb.WriteString("(;GM[1]FF[4]SZ[19]")
+
+	for i := 0; i < 200; i++ {
+
+		fmt.Fprintf(&sb, ";%s[%s]C[Move %d. %s]", bench_colour(i), bench_point(i), i + 1, comment)
+
+		for v := 0; v < 20; v++ {
+			sb.WriteString("(")
+			for n := 0; n < 5; n++ {
+				fmt.Fprintf(&sb, ";%s[%s]C[%s]", bench_colour(i + 1 + n), bench_point(i + 1 + v + n), comment)
+			}
+			sb.WriteString(")")
+		}
+
+		sb.WriteString("(")
+	}
+
+	sb.WriteString(";C[End])")
+	sb.WriteString(strings.Repeat(")", 200))
+
+	return sb.String()
+}
+
+
+func deep_sgf() string {
+
+	var sb strings.Builder
+	sb.WriteString("(;GM[1]FF[4]SZ[19]")
+
+	for i := 0; i < BENCH_DEEP; i++ {
+		fmt.Fprintf(&sb, "(;%s[%s]C[%d]", bench_colour(i), bench_point(i), i)
+	}
+
+	sb.WriteString(strings.Repeat(")", BENCH_DEEP + 1))
+
+	return sb.String()
+}
+
+
+func bench_inputs() []bench_input {
+	return []bench_input{
+		{"wide", wide_sgf()},
+		{"deep", deep_sgf()},
+	}
+}
+
+
+func BenchmarkLoad(b *testing.B) {
+
+	for _, input := range bench_inputs() {
+
+		sgf := input.sgf
+
+		b.Run(input.name, func(b *testing.B) {
+
+			b.SetBytes(int64(len(sgf)))
+
+			for i := 0; i < b.N; i++ {
+				root, err := load_sgf(sgf, false)
+				if err != nil {
+					b.Fatal(err)
+				}
+				root.make_board_recursive()
+			}
+		})
+	}
+}
+
+
+func BenchmarkWriteTree(b *testing.B) {
+
+	for _, input := range bench_inputs() {
+
+		sgf := input.sgf
+
+		b.Run(input.name, func(b *testing.B) {
+
+			root, err := load_sgf(sgf, false)
+			if err != nil {
+				b.Fatal(err)
+			}
+			root.make_board_recursive()
+
+			b.SetBytes(int64(len(sgf)))
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				root.WriteTree(ioutil.Discard)
+			}
+		})
+	}
+}
+
+// -------------------------------------------------------------------------
+
+func TestGTPCompressedSetup(t *testing.T) {
+
+	// AB[aa:bb] is 4 stones; an engine must be sent all of them.
+
+	root, err := load_sgf("(;SZ[9]AB[aa:bb]AW[cc];B[dd])", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root.make_board_recursive()
+
+	want := []string{
+		"boardsize 9",
+		"clear_board",
+		"play B A9",
+		"play B A8",
+		"play B B9",
+		"play B B8",
+		"play W C7",
+		"play B D6",
+	}
+
+	got := root.Children[0].FullGTP()
+
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("FullGTP() gave %q, want %q", got, want)
+	}
+
+	if n := len(root.StepGTP()); n != 5 {
+		t.Errorf("StepGTP() for the root gave %d commands, want 5", n)
+	}
+}
+
+// -------------------------------------------------------------------------
+// The round-trip corpus: every file in testdata/roundtrip must come back
+// byte-for-byte from LoadVerbatim() and Save().
+
+func TestVerbatimRoundTrip(t *testing.T) {
+
+	files, err := filepath.Glob(filepath.Join("testdata", "roundtrip", "*.sgf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) == 0 {
+		t.Fatal("no files in testdata/roundtrip")
+	}
+
+	dir := t.TempDir()
+
+	for _, filename := range files {
+
+		original, err := ioutil.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		root, err := LoadVerbatim(filename)
+		if err != nil {
+			t.Errorf("%s: %v", filename, err)
+			continue
+		}
+
+		outname := filepath.Join(dir, filepath.Base(filename))
+
+		err = root.Save(outname)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		saved, err := ioutil.ReadFile(outname)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if bytes.Equal(original, saved) == false {
+			t.Errorf("%s: round trip differs; got:\n%s", filename, saved)
+		}
+	}
+}
+
+
+func TestVerbatimEdited(t *testing.T) {
+
+	// An edited node is written normally, and the rest as before.
+
+	sgf := "(;GM[1]FF[4]SZ[9]\n;B[ee]C[old]  LZ[1][1]\n;W[cc]\n)\n"
+
+	root, err := load_sgf(sgf, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root.make_board_recursive()
+
+	root.Children[0].SetValue("GN", "new")
+
+	var buf bytes.Buffer
+	root.WriteTree(&buf)
+
+	want := "(;GM[1]FF[4]SZ[9]\n;B[ee]C[old]LZ[1][1]GN[new]\n;W[cc]\n)\n"
+
+	if buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
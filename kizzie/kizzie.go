@@ -438,15 +438,15 @@ func (self *App) Poll() {
 			if event.Y > 0 {
 
 				if self.Node.Parent != nil {
-					self.Node = self.Node.Parent
+					self.Node = self.Node.Back()
 					self.Sync()
 				}
 			}
 
-			if event.Y < 0 {		// Ideally we'd remember which line of the game we've been in.
+			if event.Y < 0 {		// Forward() remembers which line of the game we've been in.
 
 				if len(self.Node.Children) > 0 {
-					self.Node = self.Node.Children[0]
+					self.Node = self.Node.Forward()
 					self.Sync()
 				}
 			}
@@ -569,7 +569,7 @@ func (self *App) Poll() {
 
 				case sdl.K_END:
 
-					self.Node = self.Node.GetEnd()
+					self.Node = self.Node.GetLineEnd()
 					self.Sync()
 
 				case sdl.K_HOME:
@@ -580,14 +580,14 @@ func (self *App) Poll() {
 				case sdl.K_DOWN:
 
 					if len(self.Node.Children) > 0 {
-						self.Node = self.Node.Children[0]
+						self.Node = self.Node.Forward()
 						self.Sync()
 					}
 
 				case sdl.K_UP:
 
 					if self.Node.Parent != nil {
-						self.Node = self.Node.Parent
+						self.Node = self.Node.Back()
 						self.Sync()
 					}
 				}
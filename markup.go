@@ -0,0 +1,269 @@
+package kikashi
+
+import (
+	"fmt"
+	"strings"
+)
+
+// -------------------------------------------------------------------------
+// Typed markup. Point markup may be stored as compressed lists ("aa:cc" is
+// the rectangle from aa to cc) which are expanded on reading. LB values are
+// "point:text" and AR / LN values are "point:point".
+
+var MARKUP_POINT_KEYS = []string{"TR", "SQ", "CR", "MA", "SL", "DD"}
+
+type Label struct {
+	Point
+	Text			string
+}
+
+type Arrow struct {					// Also used for lines (LN).
+	From			Point
+	To				Point
+}
+
+type Markup struct {
+	Triangles		[]Point			// TR
+	Squares			[]Point			// SQ
+	Circles			[]Point			// CR
+	Crosses			[]Point			// MA
+	Selected		[]Point			// SL
+	Dimmed			[]Point			// DD
+	Labels			[]Label			// LB
+	Arrows			[]Arrow			// AR
+	Lines			[]Arrow			// LN
+}
+
+
+func (self Point) SGFString() string {
+	return SGFStringFromPoint(self.X, self.Y)
+}
+
+
+func PointFromSGF(s string, size int) (Point, bool) {
+	x, y, ok := PointFromSGFString(s, size)
+	return Point{x, y}, ok
+}
+
+
+func (self *Node) GetMarkup() Markup {
+
+	// Everything at once, for renderers.
+
+	return Markup{
+		Triangles: self.MarkupPoints("TR"),
+		Squares: self.MarkupPoints("SQ"),
+		Circles: self.MarkupPoints("CR"),
+		Crosses: self.MarkupPoints("MA"),
+		Selected: self.MarkupPoints("SL"),
+		Dimmed: self.MarkupPoints("DD"),
+		Labels: self.Labels(),
+		Arrows: self.Arrows(),
+		Lines: self.Lines(),
+	}
+}
+
+
+func (self *Node) MarkupPoints(key string) []Point {
+
+	check_markup_key(key, "MarkupPoints")
+	return points_from_list(self.AllValues(key), self.Size())
+}
+
+
+func (self *Node) AddMarkup(key string, p Point) {
+
+	check_markup_key(key, "AddMarkup")
+
+	for _, existing := range self.MarkupPoints(key) {
+		if existing == p {
+			return
+		}
+	}
+
+	self.add_value(key, p.SGFString())
+}
+
+
+func (self *Node) RemoveMarkup(key string, p Point) {
+
+	// Rewrites the list uncompressed, in case p was inside a compressed rectangle.
+
+	check_markup_key(key, "RemoveMarkup")
+
+	points := self.MarkupPoints(key)
+	self.delete_key(key)
+
+	for _, existing := range points {
+		if existing != p {
+			self.add_value(key, existing.SGFString())
+		}
+	}
+}
+
+
+func (self *Node) Labels() []Label {
+
+	var ret []Label
+
+	for _, s := range self.AllValues("LB") {
+
+		parts := strings.SplitN(s, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		p, ok := PointFromSGF(parts[0], self.Size())
+		if ok {
+			ret = append(ret, Label{p, parts[1]})
+		}
+	}
+
+	return ret
+}
+
+
+func (self *Node) AddLabel(p Point, text string) {
+
+	// Replaces any existing label at the point.
+
+	self.RemoveLabel(p)
+	self.add_value("LB", p.SGFString() + ":" + text)
+}
+
+
+func (self *Node) RemoveLabel(p Point) {
+
+	labels := self.Labels()
+	self.delete_key("LB")
+
+	for _, label := range labels {
+		if label.Point != p {
+			self.add_value("LB", label.Point.SGFString() + ":" + label.Text)
+		}
+	}
+}
+
+
+func (self *Node) Arrows() []Arrow {
+	return arrows_from_values(self.AllValues("AR"), self.Size())
+}
+
+
+func (self *Node) AddArrow(from, to Point) error {
+
+	// SGF forbids an arrow from a point to itself.
+
+	if from == to {
+		return fmt.Errorf("AddArrow(): from and to are the same point")
+	}
+
+	self.add_value("AR", from.SGFString() + ":" + to.SGFString())
+	return nil
+}
+
+
+func (self *Node) Lines() []Arrow {
+	return arrows_from_values(self.AllValues("LN"), self.Size())
+}
+
+
+func (self *Node) AddLine(from, to Point) error {
+
+	// SGF forbids a line from a point to itself.
+
+	if from == to {
+		return fmt.Errorf("AddLine(): from and to are the same point")
+	}
+
+	self.add_value("LN", from.SGFString() + ":" + to.SGFString())
+	return nil
+}
+
+
+func (self *Node) ClearMarkup() {
+
+	// Delete all markup of all kinds from this node.
+
+	for _, key := range MARKUP_POINT_KEYS {
+		self.delete_key(key)
+	}
+
+	self.delete_key("LB")
+	self.delete_key("AR")
+	self.delete_key("LN")
+}
+
+// -------------------------------------------------------------------------
+
+func points_from_list(values []string, size int) []Point {
+
+	// Expand a point list, including compressed rectangles. Invalid
+	// entries are ignored, as are duplicates.
+
+	var ret []Point
+	seen := make(map[Point]bool)
+
+	for _, s := range values {
+
+		parts := strings.SplitN(s, ":", 2)
+
+		first, ok := PointFromSGF(parts[0], size)
+		if ok == false {
+			continue
+		}
+
+		last := first
+
+		if len(parts) == 2 {
+			last, ok = PointFromSGF(parts[1], size)
+			if ok == false {
+				continue
+			}
+		}
+
+		x1, x2 := first.X, last.X ; if x1 > x2 { x1, x2 = x2, x1 }
+		y1, y2 := first.Y, last.Y ; if y1 > y2 { y1, y2 = y2, y1 }
+
+		for x := x1; x <= x2; x++ {
+			for y := y1; y <= y2; y++ {
+				if seen[Point{x, y}] == false {
+					seen[Point{x, y}] = true
+					ret = append(ret, Point{x, y})
+				}
+			}
+		}
+	}
+
+	return ret
+}
+
+
+func arrows_from_values(values []string, size int) []Arrow {
+
+	var ret []Arrow
+
+	for _, s := range values {
+
+		parts := strings.SplitN(s, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		from, ok1 := PointFromSGF(parts[0], size)
+		to, ok2 := PointFromSGF(parts[1], size)
+
+		if ok1 && ok2 && from != to {
+			ret = append(ret, Arrow{from, to})
+		}
+	}
+
+	return ret
+}
+
+
+func check_markup_key(key, caller string) {
+	if string_in_slice(key, MARKUP_POINT_KEYS) == false {
+		panic(fmt.Sprintf("%s(): %q is not a point markup property", caller, key))
+	}
+}
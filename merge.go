@@ -0,0 +1,267 @@
+package kikashi
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+)
+
+// -------------------------------------------------------------------------
+// Merging several game trees into one, e.g. to build an opening tree from a
+// collection of games. Identical move sequences are shared.
+
+var TEXT_PROPS = []string{"C", "GC"}		// Concatenated when they conflict.
+
+var LIST_PROPS = []string{					// Values are unioned. Other properties keep the existing value.
+	"AR", "CR", "DD", "LB", "LN", "MA", "SL", "SQ", "TB", "TR", "TW",
+}
+
+
+func MergeTrees(trees []*Node, by_position bool) (*Node, error) {
+
+	// Returns a new tree; the inputs are not modified.
+
+	if len(trees) == 0 {
+		return nil, fmt.Errorf("MergeTrees(): no trees")
+	}
+
+	root := trees[0].GetRoot().Copy()
+
+	for _, tree := range trees[1:] {
+		err := root.Merge(tree, by_position)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return root, nil
+}
+
+
+func (self *Node) Merge(other *Node, by_position bool) error {
+
+	// Merge the whole of other's tree into this node's tree. The roots must
+	// have the same starting position. If by_position is set, a new line that
+	// transposes into a position already in the tree has its continuations
+	// (and comments) merged into the existing node, rather than kept below
+	// the new move.
+	// Nodes from other are copied, never shared.
+
+	dst_root := self.GetRoot()
+	src_root := other.GetRoot()
+
+	if dst_root.Size() != src_root.Size() {
+		return fmt.Errorf("Merge(): board size mismatch (%d vs %d)", dst_root.Size(), src_root.Size())
+	}
+
+	if dst_root.SameBoard(src_root) == false {
+		return fmt.Errorf("Merge(): roots have different starting positions")
+	}
+
+	var index map[uint64][]*Node
+
+	if by_position {
+		index = make(map[uint64][]*Node)
+		stack := []*Node{dst_root}
+		for len(stack) > 0 {
+			node := stack[len(stack) - 1]
+			stack = stack[:len(stack) - 1]
+			index[node.BoardHash()] = append(index[node.BoardHash()], node)
+			stack = append(stack, node.Children...)
+		}
+	}
+
+	type pair struct {
+		dst			*Node
+		src			*Node
+	}
+
+	stack := []pair{{dst_root, src_root}}
+
+	for len(stack) > 0 {
+
+		p := stack[len(stack) - 1]
+		stack = stack[:len(stack) - 1]
+
+		merge_props(p.dst, p.src)
+
+		for _, src_child := range p.src.Children {
+
+			key := node_identity(src_child)
+
+			var dst_child *Node
+
+			for _, c := range p.dst.Children {
+				if node_identity(c) == key {
+					dst_child = c
+					break
+				}
+			}
+
+			if dst_child != nil {
+				stack = append(stack, pair{dst_child, src_child})
+				continue
+			}
+
+			// A line that transposes into a position already in the tree is
+			// merged into that node, without making a child here at all. The
+			// source child's board is the one the new child would have, since
+			// p.dst and p.src always have the same position.
+
+			if by_position {
+
+				var target *Node
+
+				for _, candidate := range index[src_child.BoardHash()] {
+					if candidate.same_position(src_child) {
+						target = candidate
+						break
+					}
+				}
+
+				if target != nil {
+					stack = append(stack, pair{target, src_child})
+					continue
+				}
+			}
+
+			// No existing child or position, so make one...
+
+			dst_child = new_bare_node(p.dst)
+			dst_child.Props = copy_props(src_child.Props)
+			dst_child.key_order = append([]string(nil), src_child.key_order...)
+			dst_child.make_board()
+
+			if by_position {
+				index[dst_child.BoardHash()] = append(index[dst_child.BoardHash()], dst_child)
+			}
+
+			stack = append(stack, pair{dst_child, src_child})
+		}
+	}
+
+	return nil
+}
+
+
+func (self *Node) BoardHash() uint64 {
+
+	// A hash of the position: the stones on the board, the side to move, and
+	// whether the line reached it by one or two passes (so that the position
+	// after the game has ended is not the one before it). Different positions
+	// can in principle collide, so confirm with same_position().
+
+	h := fnv.New64a()
+
+	for x := 0; x < len(self.Board); x++ {
+		buf := make([]byte, len(self.Board[x]))
+		for y := 0; y < len(self.Board[x]); y++ {
+			buf[y] = byte(self.Board[x][y])
+		}
+		h.Write(buf)
+	}
+
+	h.Write([]byte{byte(self.NextColour()), byte(self.trailing_passes())})
+	return h.Sum64()
+}
+
+
+func (self *Node) same_position(other *Node) bool {
+	return self.SameBoard(other) && self.NextColour() == other.NextColour() && self.trailing_passes() == other.trailing_passes()
+}
+
+
+func (self *Node) trailing_passes() int {
+
+	// How many passes in a row ended at this node, counting at most 2 (the
+	// game is over). Nodes without moves are skipped over.
+
+	n := 0
+
+	for node := self; node != nil && n < 2; node = node.Parent {
+		mv := node.MoveInfo()
+		if mv.OK == false {
+			continue
+		}
+		if mv.Pass == false {
+			break
+		}
+		n++
+	}
+
+	return n
+}
+
+
+func node_identity(node *Node) string {
+
+	// Two children of the same parent are "the same" if they play the same
+	// move and have the same setup stones. Other properties don't matter.
+
+	var parts []string
+
+	mv := node.MoveInfo()
+
+	if mv.OK {
+		if mv.Pass {
+			parts = append(parts, fmt.Sprintf("%s:pass", COLMAP[mv.Colour]))
+		} else {
+			parts = append(parts, fmt.Sprintf("%s:%d,%d", COLMAP[mv.Colour], mv.X, mv.Y))
+		}
+	}
+
+	for _, key := range []string{"AB", "AW", "AE"} {
+		values := append([]string(nil), node.Props[key]...)
+		sort.Strings(values)
+		parts = append(parts, key + ":" + strings.Join(values, ","))
+	}
+
+	return strings.Join(parts, ";")
+}
+
+
+func merge_props(dst, src *Node) {
+
+	// Values go through the usual node methods, so that escaping and the
+	// record of keys stays right. Text is merged by whole paragraphs, so a
+	// comment is only skipped if it's already there in full.
+
+	for _, key := range src.ordered_keys() {
+
+		if is_mutor(key) {
+			continue
+		}
+
+		values := src.AllValues(key)
+
+		if len(values) == 0 {
+			continue
+		}
+
+		if len(dst.Props[key]) == 0 {
+			for _, v := range values {
+				dst.add_value(key, v)
+			}
+			continue
+		}
+
+		if string_in_slice(key, TEXT_PROPS) {
+			old, _ := dst.GetValue(key)
+			paragraphs := strings.Split(old, "\n\n")
+			for _, p := range strings.Split(values[0], "\n\n") {
+				if string_in_slice(p, paragraphs) == false {
+					paragraphs = append(paragraphs, p)
+				}
+			}
+			dst.SetValue(key, strings.Join(paragraphs, "\n\n"))
+			continue
+		}
+
+		if string_in_slice(key, LIST_PROPS) {
+			for _, v := range values {
+				dst.add_value(key, v)
+			}
+		}
+	}
+}
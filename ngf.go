@@ -0,0 +1,278 @@
+package kikashi
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// -------------------------------------------------------------------------
+// WBaduk / Cyberoro .ngf files. These are line based:
+//
+//		0		title
+//		1		board size
+//		2		white player and rank
+//		3		black player and rank
+//		4		website
+//		5		handicap
+//		6		(unused)
+//		7		komi
+//		8		date, as YYYYMMDD followed by the time
+//		9		(unused)
+//		10		result, in English
+//		11		number of moves
+//		12...	moves, e.g. "PMABBQEQE": "PM", 2 characters of move number,
+//				colour, then x and y with "B" meaning 0 (so "A" is a pass).
+//
+// The format has no variations or comments.
+
+var ngf_margin_regexp = regexp.MustCompile(`[0-9]+(\.[0-9]+)?`)
+
+
+func LoadNGF(filename string) (*Node, error) {
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseNGF(data)
+}
+
+
+func ParseNGF(data []byte) (*Node, error) {
+
+	// If some moves were illegal, returns the tree anyway, with an IllegalMoves error.
+
+	var lines []string
+	for _, line := range strings.Split(string(data), "\n") {
+		lines = append(lines, strings.TrimSpace(line))
+	}
+
+	if len(lines) < 12 {
+		return nil, fmt.Errorf("ParseNGF(): too few lines")
+	}
+
+	size, err := strconv.Atoi(lines[1])
+	if err != nil || size < 1 || size > 25 {
+		return nil, fmt.Errorf("ParseNGF(): bad board size %q", lines[1])
+	}
+
+	handicap, _ := strconv.Atoi(lines[5])
+
+	root := new_import_root(size, handicap)
+
+	if lines[0] != "" {
+		root.SetValue("GN", lines[0])
+	}
+
+	for _, item := range [][3]string{{lines[2], "PW", "WR"}, {lines[3], "PB", "BR"}} {
+		fields := strings.Fields(item[0])
+		if len(fields) > 0 {
+			root.SetValue(item[1], fields[0])
+		}
+		if len(fields) > 1 {
+			root.SetValue(item[2], fields[1])
+		}
+	}
+
+	if komi, err := strconv.ParseFloat(lines[7], 64); err == nil {
+		root.SetValue("KM", FormatReal(komi))
+	}
+
+	if len(lines[8]) >= 8 {
+		y, err1 := strconv.Atoi(lines[8][0:4])
+		m, err2 := strconv.Atoi(lines[8][4:6])
+		d, err3 := strconv.Atoi(lines[8][6:8])
+		date := GameDate{y, m, d}
+		if err1 == nil && err2 == nil && err3 == nil && date.Valid() {
+			root.SetValue("DT", date.String())
+		}
+	}
+
+	if result := ngf_result(lines[10]); result != "" {
+		root.SetValue("RE", result)
+	}
+
+	var illegal IllegalMoves
+	node := root
+	number := 0
+
+	for _, line := range lines[12:] {
+
+		if len(line) < 7 || line[0:2] != "PM" {
+			continue
+		}
+
+		number++
+
+		var colour Colour
+
+		switch line[4] {
+		case 'B': colour = BLACK
+		case 'W': colour = WHITE
+		default:
+			illegal = append(illegal, fmt.Errorf("unreadable move: %s", line))
+			continue
+		}
+
+		x := int(line[5]) - 'B'
+		y := int(line[6]) - 'B'
+		pass := x < 0 || x >= size || y < 0 || y >= size
+
+		node = play_imported_move(node, colour, x, y, pass, number, &illegal)
+	}
+
+	if len(illegal) > 0 {
+		return root, illegal
+	}
+
+	return root, nil
+}
+
+
+func ngf_result(s string) string {
+
+	lower := strings.ToLower(s)
+
+	var ret string
+
+	if strings.Contains(lower, "white win") {
+		ret = "W+"
+	} else if strings.Contains(lower, "black win") {
+		ret = "B+"
+	} else {
+		return ""
+	}
+
+	if strings.Contains(lower, "resign") {
+		ret += "R"
+	} else if strings.Contains(lower, "time") {
+		ret += "T"
+	} else if margin := ngf_margin_regexp.FindString(lower); margin != "" {
+		ret += margin
+	}
+
+	return ret
+}
+
+
+func (self *Node) SaveNGF(filename string) error {
+
+	// Saves the main line (following Children[0]) from the root; NGF can't
+	// hold variations. Setup stones other than standard handicap are lost.
+
+	outfile, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer outfile.Close()
+
+	w := bufio.NewWriter(outfile)
+	defer w.Flush()
+
+	return self.GetRoot().WriteNGF(w)
+}
+
+
+func (self *Node) WriteNGF(outfile io.Writer) error {
+
+	root := self.GetRoot()
+	info := root.GetGameInfo()
+	sz := root.Size()
+
+	if sz > 25 {
+		return fmt.Errorf("WriteNGF(): board too large")
+	}
+
+	var moves []Move
+
+	it := root.MainLine()
+	for node := it.Next(); node != nil; node = it.Next() {
+		if mv := node.MoveInfo(); mv.OK {
+			moves = append(moves, mv)
+		}
+	}
+
+	date := "00000000"
+	if len(info.Dates) > 0 {
+		d := info.Dates[0]
+		date = fmt.Sprintf("%04d%02d%02d", d.Year, d.Month, d.Day)
+	}
+
+	title, _ := root.GetValue("GN")
+
+	lines := []string{
+		title,
+		fmt.Sprintf("%d", sz),
+		strings.TrimSpace(ngf_name(info.PlayerWhite) + " " + info.RankWhite),
+		strings.TrimSpace(ngf_name(info.PlayerBlack) + " " + info.RankBlack),
+		"kikashi",
+		fmt.Sprintf("%d", info.Handicap),
+		"0",
+		FormatReal(info.Komi),
+		date + " [00:00]",
+		"5",
+		ngf_result_text(info.Result),
+		fmt.Sprintf("%d", len(moves)),
+	}
+
+	for i, mv := range moves {
+
+		n := i + 1
+		x, y := -1, -1
+
+		if mv.Pass == false {
+			x, y = mv.X, mv.Y
+		}
+
+		coords := string([]byte{byte('B' + x), byte('B' + y)})
+		lines = append(lines, fmt.Sprintf("PM%c%c%s%s%s", 'A' + (n / 26) % 26, 'A' + n % 26, COLMAP[mv.Colour], coords, coords))
+	}
+
+	for _, line := range lines {
+		_, err := fmt.Fprintf(outfile, "%s\r\n", line)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+
+func ngf_name(s string) string {
+
+	// The reader takes the first word as the name.
+
+	s = strings.Join(strings.Fields(s), "_")
+	if s == "" {
+		return "?"
+	}
+	return s
+}
+
+
+func ngf_result_text(r Result) string {
+
+	if r.Winner != BLACK && r.Winner != WHITE {
+		return ""
+	}
+
+	who := r.Winner.Name()
+
+	if r.Resign {
+		return who + " wins by resignation!"
+	} else if r.Time {
+		return who + " wins on time!"
+	} else if r.Margin != 0 {
+		return fmt.Sprintf("%s wins by %s!", who, FormatReal(r.Margin))
+	}
+
+	return who + " wins!"
+}
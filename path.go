@@ -0,0 +1,238 @@
+package kikashi
+
+import (
+	"fmt"
+)
+
+// -------------------------------------------------------------------------
+// Navigation. A path is the list of child indices leading from the root
+// (or some other starting node) to a node; the root's own path is empty.
+
+
+func (self *Node) Path() []int {
+
+	var reversed []int
+
+	node := self
+
+	for node.Parent != nil {
+		reversed = append(reversed, node.SiblingIndex())
+		node = node.Parent
+	}
+
+	path := make([]int, len(reversed))
+
+	for i, n := range reversed {
+		path[len(reversed) - 1 - i] = n
+	}
+
+	return path
+}
+
+
+func (self *Node) NodeAtPath(path []int) (*Node, error) {
+
+	// The path is relative to this node, which is normally the root.
+
+	node := self
+
+	for depth, n := range path {
+		if n < 0 || n >= len(node.Children) {
+			return nil, fmt.Errorf("NodeAtPath(): no child %d at depth %d", n, depth)
+		}
+		node = node.Children[n]
+	}
+
+	return node, nil
+}
+
+
+func (self *Node) SiblingIndex() int {
+
+	// Our index in our parent's Children. The root returns 0.
+
+	if self.Parent == nil {
+		return 0
+	}
+
+	for i, child := range self.Parent.Children {
+		if child == self {
+			return i
+		}
+	}
+
+	panic("SiblingIndex(): node not found in parent's children")
+}
+
+
+func (self *Node) Depth() int {
+
+	depth := 0
+
+	for node := self; node.Parent != nil; node = node.Parent {
+		depth++
+	}
+
+	return depth
+}
+
+
+func (self *Node) MoveNumber() int {
+
+	// The number of moves (B or W, including passes) from the root to here.
+
+	n := 0
+
+	for node := self; node != nil; node = node.Parent {
+		if node.MoveInfo().OK {
+			n++
+		}
+	}
+
+	return n
+}
+
+
+func (self *Node) NodeAtMoveNumber(n int) (*Node, error) {
+
+	// Searches the current line: first back towards the root, then forwards
+	// following the remembered line (see Forward()). Returns the node where
+	// move n was played, or the root when n is 0.
+
+	if n < 0 {
+		return nil, fmt.Errorf("NodeAtMoveNumber(): negative move number")
+	}
+
+	node := self
+	current := self.MoveNumber()
+
+	for current > n {
+		if node.MoveInfo().OK {
+			current--
+		}
+		node = node.Parent
+	}
+
+	for current < n {
+
+		next := node.Forward()
+
+		if next == node {
+			return nil, fmt.Errorf("NodeAtMoveNumber(): line ends before move %d", n)
+		}
+
+		node = next
+
+		if node.MoveInfo().OK {
+			current++
+		}
+	}
+
+	// Back up over any non-move nodes that share this number...
+
+	for node.Parent != nil && node.MoveInfo().OK == false {
+		node = node.Parent
+	}
+
+	return node, nil
+}
+
+
+func (self *Node) NextVariation() *Node {
+
+	// The next sibling, or this node if there isn't one.
+
+	if self.Parent == nil {
+		return self
+	}
+
+	i := self.SiblingIndex()
+
+	if i + 1 < len(self.Parent.Children) {
+		sibling := self.Parent.Children[i + 1]
+		self.Parent.last_visited = sibling
+		return sibling
+	}
+
+	return self
+}
+
+
+func (self *Node) PrevVariation() *Node {
+
+	// The previous sibling, or this node if there isn't one.
+
+	if self.Parent == nil {
+		return self
+	}
+
+	i := self.SiblingIndex()
+
+	if i > 0 {
+		sibling := self.Parent.Children[i - 1]
+		self.Parent.last_visited = sibling
+		return sibling
+	}
+
+	return self
+}
+
+
+func (self *Node) Forward() *Node {
+
+	// Go to the child we were last in, if it still exists, else the first child.
+	// If there are no children at all, returns this node.
+
+	if len(self.Children) == 0 {
+		return self
+	}
+
+	for _, child := range self.Children {
+		if child == self.last_visited {
+			return child
+		}
+	}
+
+	self.last_visited = self.Children[0]
+	return self.Children[0]
+}
+
+
+func (self *Node) Back() *Node {
+
+	// Go to the parent, remembering that we came from here.
+	// The root returns itself.
+
+	if self.Parent == nil {
+		return self
+	}
+
+	self.Parent.last_visited = self
+	return self.Parent
+}
+
+
+func (self *Node) SetLastVisited() {
+
+	// Mark this node, and all its ancestors, as the remembered line.
+
+	for node := self; node.Parent != nil; node = node.Parent {
+		node.Parent.last_visited = node
+	}
+}
+
+
+func (self *Node) GetLineEnd() *Node {
+
+	// Like GetEnd(), but follows the remembered line rather than Children[0].
+
+	node := self
+
+	for {
+		next := node.Forward()
+		if next == node {
+			return node
+		}
+		node = next
+	}
+}
@@ -0,0 +1,334 @@
+package kikashi
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"io"
+	"math"
+	"os"
+	"strings"
+)
+
+// -------------------------------------------------------------------------
+// Raster output, using only the standard library. Text (coordinates, move
+// numbers and labels) uses the tiny bitmap font below, scaled up to suit
+// the cell width; lowercase letters are drawn as capitals.
+
+var TINY_FONT = map[rune][5]string{
+	'0': {"###", "#.#", "#.#", "#.#", "###"},
+	'1': {".#.", "##.", ".#.", ".#.", "###"},
+	'2': {"###", "..#", "###", "#..", "###"},
+	'3': {"###", "..#", "###", "..#", "###"},
+	'4': {"#.#", "#.#", "###", "..#", "..#"},
+	'5': {"###", "#..", "###", "..#", "###"},
+	'6': {"###", "#..", "###", "#.#", "###"},
+	'7': {"###", "..#", ".#.", ".#.", ".#."},
+	'8': {"###", "#.#", "###", "#.#", "###"},
+	'9': {"###", "#.#", "###", "..#", "###"},
+	'A': {".#.", "#.#", "###", "#.#", "#.#"},
+	'B': {"##.", "#.#", "##.", "#.#", "##."},
+	'C': {".##", "#..", "#..", "#..", ".##"},
+	'D': {"##.", "#.#", "#.#", "#.#", "##."},
+	'E': {"###", "#..", "##.", "#..", "###"},
+	'F': {"###", "#..", "##.", "#..", "#.."},
+	'G': {".##", "#..", "#.#", "#.#", ".##"},
+	'H': {"#.#", "#.#", "###", "#.#", "#.#"},
+	'I': {"###", ".#.", ".#.", ".#.", "###"},
+	'J': {"..#", "..#", "..#", "#.#", ".#."},
+	'K': {"#.#", "#.#", "##.", "#.#", "#.#"},
+	'L': {"#..", "#..", "#..", "#..", "###"},
+	'M': {"#.#", "###", "###", "#.#", "#.#"},
+	'N': {"##.", "#.#", "#.#", "#.#", "#.#"},
+	'O': {".#.", "#.#", "#.#", "#.#", ".#."},
+	'P': {"##.", "#.#", "##.", "#..", "#.."},
+	'Q': {".#.", "#.#", "#.#", "##.", ".##"},
+	'R': {"##.", "#.#", "##.", "#.#", "#.#"},
+	'S': {".##", "#..", ".#.", "..#", "##."},
+	'T': {"###", ".#.", ".#.", ".#.", ".#."},
+	'U': {"#.#", "#.#", "#.#", "#.#", "###"},
+	'V': {"#.#", "#.#", "#.#", "#.#", ".#."},
+	'W': {"#.#", "#.#", "###", "###", "#.#"},
+	'X': {"#.#", "#.#", ".#.", "#.#", "#.#"},
+	'Y': {"#.#", "#.#", ".#.", ".#.", ".#."},
+	'Z': {"###", "..#", ".#.", "#..", "###"},
+	'?': {"###", "..#", ".#.", "...", ".#."},
+}
+
+
+func (self *Node) Image(opts RenderOptions) *image.RGBA {
+	opts = opts.with_defaults()
+	return self.render_scene(opts).draw_image(opts)
+}
+
+
+func (self *Node) SavePNG(filename string, opts RenderOptions) error {
+
+	outfile, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer outfile.Close()
+
+	w := bufio.NewWriter(outfile)
+	defer w.Flush()
+
+	return self.WritePNG(w, opts)
+}
+
+
+func (self *Node) WritePNG(outfile io.Writer, opts RenderOptions) error {
+	return png.Encode(outfile, self.Image(opts))
+}
+
+
+func (self *Node) SaveGIF(filename string, opts RenderOptions, delay int) error {
+
+	outfile, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer outfile.Close()
+
+	w := bufio.NewWriter(outfile)
+	defer w.Flush()
+
+	return self.WriteGIF(w, opts, delay)
+}
+
+
+func (self *Node) WriteGIF(outfile io.Writer, opts RenderOptions, delay int) error {
+
+	// An animation of the line from the root to this node, one frame per
+	// node. The delay is per frame, in 100ths of a second.
+
+	opts = opts.with_defaults()
+
+	var line []*Node
+	for node := self; node != nil; node = node.Parent {
+		line = append([]*Node{node}, line...)
+	}
+
+	palette := color.Palette{opts.BoardColour, opts.LineColour, opts.BlackColour, opts.WhiteColour}
+
+	anim := &gif.GIF{}
+
+	for _, node := range line {
+
+		img := node.render_scene(opts).draw_image(opts)
+
+		frame := image.NewPaletted(img.Bounds(), palette)
+		draw.Draw(frame, frame.Bounds(), img, image.Point{}, draw.Src)
+
+		anim.Image = append(anim.Image, frame)
+		anim.Delay = append(anim.Delay, delay)
+	}
+
+	return gif.EncodeAll(outfile, anim)
+}
+
+
+func (self *render_scene) draw_image(opts RenderOptions) *image.RGBA {
+
+	// opts must already have its defaults set.
+
+	l := new_render_layout(self.size, opts)
+
+	img := image.NewRGBA(image.Rect(0, 0, l.width, l.width))
+	draw.Draw(img, img.Bounds(), &image.Uniform{opts.BoardColour}, image.Point{}, draw.Src)
+
+	// The grid...
+
+	for i := 0; i < self.size; i++ {
+		x1, y1 := l.pixel_xy(i, 0)
+		x2, y2 := l.pixel_xy(i, self.size - 1)
+		fill_rect(img, x1, y1, x2 + 1, y2 + 1, opts.LineColour)
+		x1, y1 = l.pixel_xy(0, i)
+		x2, y2 = l.pixel_xy(self.size - 1, i)
+		fill_rect(img, x1, y1, x2 + 1, y2 + 1, opts.LineColour)
+	}
+
+	for _, p := range star_points(self.size) {
+		x, y := l.pixel_xy(p.X, p.Y)
+		draw_ring(img, x, y, -1, float64(max_int(l.cell / 12, 2)), opts.LineColour)
+	}
+
+	// Coordinates...
+
+	scale := max_int(l.cell / 18, 1)
+
+	if opts.Coordinates {
+		near := l.margin + l.coords / 2
+		far := l.width - near
+		for i := 0; i < self.size; i++ {
+			x, y := l.pixel_xy(i, i)
+			draw_text(img, x, near, scale, opts.LineColour, l.column_label(i))
+			draw_text(img, x, far, scale, opts.LineColour, l.column_label(i))
+			draw_text(img, near, y, scale, opts.LineColour, l.row_label(i))
+			draw_text(img, far, y, scale, opts.LineColour, l.row_label(i))
+		}
+	}
+
+	// Stones, and whatever is on each point...
+
+	radius := float64(l.cell) / 2
+	thickness := float64(max_int(l.cell / 16, 1))
+
+	for x := 0; x < self.size; x++ {
+
+		for y := 0; y < self.size; y++ {
+
+			p := Point{x, y}
+			px, py := l.pixel_xy(x, y)
+			colour := self.board[x][y]
+			ink := opts.contrast(colour)
+
+			if colour == BLACK {
+				draw_ring(img, px, py, -1, radius, opts.BlackColour)
+			} else if colour == WHITE {
+				draw_ring(img, px, py, -1, radius, opts.LineColour)
+				draw_ring(img, px, py, -1, radius - 1, opts.WhiteColour)
+			}
+
+			c := float64(l.cell)
+
+			if n, ok := self.numbers[p]; ok {
+				draw_text(img, px, py, scale, ink, fmt.Sprintf("%d", n))
+			} else if text, ok := self.labels[p]; ok {
+				if colour == EMPTY {
+					draw_ring(img, px, py, -1, c * 0.4, opts.BoardColour)
+				}
+				draw_text(img, px, py, scale, ink, text)
+			} else if key, ok := self.markup[p]; ok {
+				switch key {
+				case "CR":
+					draw_ring(img, px, py, c * 0.25 - thickness, c * 0.25, ink)
+				case "SQ":
+					d := int(c * 0.2)
+					t := int(thickness)
+					fill_rect(img, px - d, py - d, px + d, py - d + t, ink)
+					fill_rect(img, px - d, py + d - t, px + d, py + d, ink)
+					fill_rect(img, px - d, py - d, px - d + t, py + d, ink)
+					fill_rect(img, px + d - t, py - d, px + d, py + d, ink)
+				case "TR":
+					ax, ay := px, py - int(c * 0.3)
+					bx, by := px - int(c * 0.26), py + int(c * 0.15)
+					cx, cy := px + int(c * 0.26), py + int(c * 0.15)
+					draw_line(img, ax, ay, bx, by, thickness, ink)
+					draw_line(img, bx, by, cx, cy, thickness, ink)
+					draw_line(img, cx, cy, ax, ay, thickness, ink)
+				case "MA":
+					d := int(c * 0.2)
+					draw_line(img, px - d, py - d, px + d, py + d, thickness, ink)
+					draw_line(img, px - d, py + d, px + d, py - d, thickness, ink)
+				}
+			} else if p == self.last {
+				draw_ring(img, px, py, -1, float64(max_int(l.cell / 8, 2)), ink)
+			}
+		}
+	}
+
+	// Arrows and lines. Arrowheads are two short strokes at the end...
+
+	for i, list := range [][]Arrow{self.arrows, self.lines} {
+		for _, a := range list {
+			x1, y1 := l.pixel_xy(a.From.X, a.From.Y)
+			x2, y2 := l.pixel_xy(a.To.X, a.To.Y)
+			draw_line(img, x1, y1, x2, y2, thickness, opts.LineColour)
+			if i == 0 && (x1 != x2 || y1 != y2) {
+				angle := math.Atan2(float64(y1 - y2), float64(x1 - x2))
+				head := float64(l.cell) / 3
+				for _, da := range []float64{-0.5, 0.5} {
+					hx := x2 + int(head * math.Cos(angle + da))
+					hy := y2 + int(head * math.Sin(angle + da))
+					draw_line(img, x2, y2, hx, hy, thickness, opts.LineColour)
+				}
+			}
+		}
+	}
+
+	return img
+}
+
+
+func fill_rect(img *image.RGBA, x1, y1, x2, y2 int, c color.RGBA) {
+	draw.Draw(img, image.Rect(x1, y1, x2, y2), &image.Uniform{c}, image.Point{}, draw.Src)
+}
+
+
+func draw_ring(img *image.RGBA, x, y int, inner, outer float64, c color.RGBA) {
+
+	// Pixels whose centres are more than inner and less than outer from the
+	// centre of pixel (x, y) - so inner -1 gives a filled circle.
+
+	r := int(outer) + 1
+
+	for j := -r; j <= r; j++ {
+		for i := -r; i <= r; i++ {
+			d := math.Sqrt(float64(i * i + j * j))
+			if d > inner && d < outer - 0.5 {
+				img.SetRGBA(x + i, y + j, c)
+			}
+		}
+	}
+}
+
+
+func draw_line(img *image.RGBA, x1, y1, x2, y2 int, thickness float64, c color.RGBA) {
+
+	// Stamps a small disc along the line.
+
+	steps := max_int(abs_int(x2 - x1), abs_int(y2 - y1))
+
+	for n := 0; n <= steps; n++ {
+		x, y := x1, y1
+		if steps > 0 {
+			x = x1 + (x2 - x1) * n / steps
+			y = y1 + (y2 - y1) * n / steps
+		}
+		draw_ring(img, x, y, -1, thickness / 2 + 1, c)
+	}
+}
+
+
+func draw_text(img *image.RGBA, x, y, scale int, c color.RGBA, text string) {
+
+	// Centred on (x, y). Each glyph is 3 x 5, with a 1 pixel gap, times scale.
+
+	runes := []rune(strings.ToUpper(text))
+
+	width := (len(runes) * 4 - 1) * scale
+	left := x - width / 2
+	top := y - (5 * scale) / 2
+
+	for n, r := range runes {
+
+		glyph, ok := TINY_FONT[r]
+		if ok == false {
+			glyph = TINY_FONT['?']
+		}
+
+		for row := 0; row < 5; row++ {
+			for col := 0; col < 3; col++ {
+				if glyph[row][col] == '#' {
+					gx := left + (n * 4 + col) * scale
+					gy := top + row * scale
+					fill_rect(img, gx, gy, gx + scale, gy + scale, c)
+				}
+			}
+		}
+	}
+}
+
+
+func abs_int(a int) int {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
+
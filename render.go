@@ -0,0 +1,190 @@
+package kikashi
+
+import (
+	"fmt"
+	"image/color"
+)
+
+// -------------------------------------------------------------------------
+// What the renderers share: options, the pixel layout (as kizzie's, with
+// CellWidth and Margin), and the "scene" - everything to be drawn, taken
+// from a node, or built up by the kifu figures.
+
+type RenderOptions struct {
+	CellWidth		int				// Pixels per point. 0 means 36.
+	Margin			int				// Pixels around the board, outside any coordinates. 0 means 20.
+	Coordinates		bool			// Draw GTP-style coordinates on all four sides.
+	NumberFrom		int				// Number the stones of moves NumberFrom to NumberTo (inclusive) that are
+	NumberTo		int				// still on the board. NumberFrom 0 means none; NumberTo 0 means no limit.
+	BoardColour		color.RGBA		// For the colours, the zero value (alpha 0) means the default.
+	LineColour		color.RGBA
+	BlackColour		color.RGBA
+	WhiteColour		color.RGBA
+}
+
+type render_layout struct {
+	size			int
+	cell			int
+	margin			int
+	offset			int
+	coords			int				// Space for coordinates on each side, or 0.
+	width			int
+}
+
+type render_scene struct {
+	size			int
+	board			[][]Colour
+	markup			map[Point]string		// "TR", "SQ", "CR" or "MA"
+	labels			map[Point]string
+	numbers			map[Point]int
+	arrows			[]Arrow
+	lines			[]Arrow
+	last			Point					// {-1, -1} if none.
+	caption			[]string				// Lines of text under the board (SVG only).
+}
+
+
+func (self RenderOptions) with_defaults() RenderOptions {
+
+	if self.CellWidth <= 0 { self.CellWidth = 36 }
+	if self.Margin <= 0 { self.Margin = 20 }
+	if self.BoardColour.A == 0 { self.BoardColour = color.RGBA{208, 172, 114, 255} }
+	if self.LineColour.A == 0 { self.LineColour = color.RGBA{0, 0, 0, 255} }
+	if self.BlackColour.A == 0 { self.BlackColour = color.RGBA{0, 0, 0, 255} }
+	if self.WhiteColour.A == 0 { self.WhiteColour = color.RGBA{255, 255, 255, 255} }
+
+	return self
+}
+
+
+func (self RenderOptions) contrast(colour Colour) color.RGBA {
+
+	// The colour to draw markup and text in, on a point of the given colour.
+
+	if colour == BLACK {
+		return self.WhiteColour
+	}
+	return self.BlackColour
+}
+
+
+func new_render_layout(size int, opts RenderOptions) render_layout {
+
+	l := render_layout{
+		size: size,
+		cell: opts.CellWidth,
+		margin: opts.Margin,
+		offset: opts.CellWidth / 2,
+	}
+
+	if opts.Coordinates {
+		l.coords = opts.CellWidth
+	}
+
+	l.width = (l.cell * size) + (l.margin * 2) + (l.coords * 2)
+	return l
+}
+
+
+func (self render_layout) pixel_xy(x, y int) (int, int) {
+	retx := x * self.cell + self.offset + self.margin + self.coords
+	rety := y * self.cell + self.offset + self.margin + self.coords
+	return retx, rety
+}
+
+
+func (self render_layout) column_label(x int) string {
+
+	// As Diagram(): GTP letters, or SGF ones if there aren't enough.
+
+	letters := "ABCDEFGHJKLMNOPQRSTUVWXYZ"
+	if self.size > len(letters) {
+		letters = ALPHA
+	}
+	return letters[x:x + 1]
+}
+
+
+func (self render_layout) row_label(y int) string {
+	return fmt.Sprintf("%d", self.size - y)
+}
+
+
+func (self *Node) render_scene(opts RenderOptions) *render_scene {
+
+	sz := self.Size()
+
+	scene := &render_scene{
+		size: sz,
+		board: self.Board,
+		markup: make(map[Point]string),
+		labels: make(map[Point]string),
+		numbers: make(map[Point]int),
+		arrows: self.Arrows(),
+		lines: self.Lines(),
+		last: Point{-1, -1},
+	}
+
+	for i := len(DIAGRAM_MARKUP_KEYS) - 1; i >= 0; i-- {			// Reversed, so the first key wins.
+		for _, p := range self.MarkupPoints(DIAGRAM_MARKUP_KEYS[i]) {
+			scene.markup[p] = DIAGRAM_MARKUP_KEYS[i]
+		}
+	}
+
+	for _, label := range self.Labels() {
+		scene.labels[label.Point] = label.Text
+	}
+
+	if mv := self.MoveInfo(); mv.OK && mv.Pass == false {
+		scene.last = Point{mv.X, mv.Y}
+	}
+
+	if opts.NumberFrom > 0 {
+
+		// Going back from here, the first move found at a point is the one
+		// whose stone (if any) is there now.
+
+		n := self.MoveNumber()
+		seen := make(map[Point]bool)
+
+		for node := self; node != nil; node = node.Parent {
+
+			mv := node.MoveInfo()
+			if mv.OK == false {
+				continue
+			}
+
+			if mv.Pass == false {
+				p := Point{mv.X, mv.Y}
+				if seen[p] == false && self.Board[mv.X][mv.Y] == mv.Colour {
+					if n >= opts.NumberFrom && (opts.NumberTo == 0 || n <= opts.NumberTo) {
+						scene.numbers[p] = n
+					}
+				}
+				seen[p] = true
+			}
+
+			n--
+		}
+	}
+
+	return scene
+}
+
+
+func star_points(size int) []Point {
+
+	ret := HandicapPoints(size, 9)
+	if ret == nil {
+		ret = HandicapPoints(size, 4)
+	}
+	return ret
+}
+
+
+func max_int(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
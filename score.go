@@ -0,0 +1,90 @@
+package kikashi
+
+// -------------------------------------------------------------------------
+// Simple area scoring. Every stone on the board is treated as alive, so
+// this is only right for games played out to the end (as between engines).
+
+
+func (self *Node) AreaScore() (black int, white int) {
+
+	// Stones, plus empty regions that touch stones of one colour only.
+
+	sz := self.Size()
+	seen := make([][]bool, sz)
+	for x := 0; x < sz; x++ {
+		seen[x] = make([]bool, sz)
+	}
+
+	for x := 0; x < sz; x++ {
+
+		for y := 0; y < sz; y++ {
+
+			switch self.Board[x][y] {
+
+			case BLACK:
+				black++
+
+			case WHITE:
+				white++
+
+			default:
+
+				if seen[x][y] {
+					continue
+				}
+
+				// Flood fill the region, noting which colours border it...
+
+				region := 0
+				touches_black, touches_white := false, false
+
+				stack := []Point{{x, y}}
+				seen[x][y] = true
+
+				for len(stack) > 0 {
+
+					p := stack[len(stack) - 1]
+					stack = stack[:len(stack) - 1]
+					region++
+
+					for _, a := range adjacent_points(p.X, p.Y, sz) {
+						switch self.Board[a.X][a.Y] {
+						case BLACK:
+							touches_black = true
+						case WHITE:
+							touches_white = true
+						default:
+							if seen[a.X][a.Y] == false {
+								seen[a.X][a.Y] = true
+								stack = append(stack, a)
+							}
+						}
+					}
+				}
+
+				if touches_black && touches_white == false {
+					black += region
+				} else if touches_white && touches_black == false {
+					white += region
+				}
+			}
+		}
+	}
+
+	return black, white
+}
+
+
+func (self *Node) AreaResult(komi float64) Result {
+
+	black, white := self.AreaScore()
+	margin := float64(black) - float64(white) - komi
+
+	if margin > 0 {
+		return Result{Winner: BLACK, Margin: margin}
+	} else if margin < 0 {
+		return Result{Winner: WHITE, Margin: -margin}
+	}
+
+	return Result{Draw: true}
+}
@@ -0,0 +1,201 @@
+package kikashi
+
+import (
+	"bufio"
+	"io"
+	"os"
+)
+
+// -------------------------------------------------------------------------
+// Reading collections of games (concatenated SGF) one game at a time, so
+// huge archives never need to be held in memory at once.
+
+type SGFReader struct {
+	MainLineOnly	bool			// Skip variations, without parsing them.
+	SkipBoards		bool			// Don't make boards. See MakeBoards().
+	Verbatim		bool			// Keep keys and duplicate values as written. See LoadVerbatim().
+
+	reader			*bufio.Reader
+	buf				[]byte
+}
+
+
+func NewSGFReader(r io.Reader) *SGFReader {
+	return &SGFReader{reader: bufio.NewReaderSize(r, 65536)}
+}
+
+
+func (self *SGFReader) Next() (*Node, error) {
+
+	// Returns the next game's root, or io.EOF when there are no more games.
+
+	chunk, err := self.next_chunk()
+	if err != nil {
+		return nil, err
+	}
+
+	root, _, err := parse_sgf_tree(chunk, self.Verbatim)
+	if err != nil {
+		return nil, err
+	}
+
+	if self.SkipBoards == false {
+		root.make_board_recursive()
+	}
+
+	return root, nil
+}
+
+
+func (self *SGFReader) next_chunk() ([]byte, error) {
+
+	// Collect the bytes of one complete game tree, from its opening "(" to
+	// the matching ")". Anything between games is ignored. A final game that
+	// is cut off is still returned, as Load() would accept it.
+	//
+	// With MainLineOnly, every variation after the first at each branch is
+	// skipped here, byte by byte, so it is never parsed or allocated.
+
+	self.buf = self.buf[:0]
+
+	var depth int
+	var inside bool
+	var escaped bool
+	closed := []bool{false}				// For each depth, whether a variation inside it has ended.
+
+	for {
+
+		c, err := self.reader.ReadByte()
+
+		if err == io.EOF {
+			if depth > 0 {
+				return self.buf, nil
+			}
+			return nil, io.EOF
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if depth == 0 && c != '(' {
+			continue
+		}
+
+		if inside {
+			self.buf = append(self.buf, c)
+			if escaped {
+				escaped = false
+			} else if c == '\\' {
+				escaped = true
+			} else if c == ']' {
+				inside = false
+			}
+			continue
+		}
+
+		if c == '(' && self.MainLineOnly && depth > 0 && closed[depth] {
+			err = self.skip_variation()
+			if err == io.EOF {
+				return self.buf, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		self.buf = append(self.buf, c)
+
+		switch c {
+		case '[':
+			inside = true
+		case '(':
+			depth++
+			closed = append(closed[:depth], false)
+		case ')':
+			depth--
+			if depth == 0 {
+				return self.buf, nil
+			}
+			closed[depth] = true
+		}
+	}
+}
+
+
+func (self *SGFReader) skip_variation() error {
+
+	// Read up to and including the ")" matching a "(" that was just read.
+
+	depth := 1
+
+	var inside bool
+	var escaped bool
+
+	for depth > 0 {
+
+		c, err := self.reader.ReadByte()
+		if err != nil {
+			return err
+		}
+
+		if inside {
+			if escaped {
+				escaped = false
+			} else if c == '\\' {
+				escaped = true
+			} else if c == ']' {
+				inside = false
+			}
+			continue
+		}
+
+		switch c {
+		case '[':
+			inside = true
+		case '(':
+			depth++
+		case ')':
+			depth--
+		}
+	}
+
+	return nil
+}
+
+
+func (self *Node) MakeBoards() {
+
+	// Make boards for the whole tree. Only needed for trees read with
+	// SkipBoards; everything else has boards already.
+
+	self.GetRoot().make_board_recursive()
+}
+
+
+func LoadCollection(filename string) ([]*Node, error) {
+
+	// Load every game in a file. (Load() only reads the first.)
+
+	infile, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer infile.Close()
+
+	var ret []*Node
+
+	reader := NewSGFReader(infile)
+
+	for {
+		root, err := reader.Next()
+		if err == io.EOF {
+			return ret, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, root)
+	}
+}
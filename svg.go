@@ -0,0 +1,203 @@
+package kikashi
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"image/color"
+	"io"
+	"os"
+	"strings"
+)
+
+// -------------------------------------------------------------------------
+// SVG output of a position. Everything is drawn with plain elements (no
+// scripts or external fonts) so the files can be embedded in web pages.
+
+
+func (self *Node) SaveSVG(filename string, opts RenderOptions) error {
+
+	outfile, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer outfile.Close()
+
+	w := bufio.NewWriter(outfile)
+	defer w.Flush()
+
+	return self.WriteSVG(w, opts)
+}
+
+
+func (self *Node) WriteSVG(outfile io.Writer, opts RenderOptions) error {
+	opts = opts.with_defaults()
+	return self.render_scene(opts).write_svg(outfile, opts)
+}
+
+
+func (self *render_scene) write_svg(outfile io.Writer, opts RenderOptions) error {
+
+	// opts must already have its defaults set.
+
+	l := new_render_layout(self.size, opts)
+
+	line_height := l.cell * 3 / 5
+	height := l.width
+	if len(self.caption) > 0 {
+		height += len(self.caption) * line_height + l.margin
+	}
+
+	var b strings.Builder
+
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">` + "\n", l.width, height, l.width, height)
+
+	if len(self.arrows) > 0 {
+		b.WriteString(`<defs><marker id="arrowhead" markerWidth="6" markerHeight="6" refX="5" refY="3" orient="auto">`)
+		fmt.Fprintf(&b, `<path d="M0,0 L6,3 L0,6 z" fill="%s"/></marker></defs>` + "\n", svg_colour(opts.LineColour))
+	}
+
+	fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="%s"/>` + "\n", l.width, height, svg_colour(opts.BoardColour))
+
+	// The grid...
+
+	for i := 0; i < self.size; i++ {
+		x1, y1 := l.pixel_xy(i, 0)
+		x2, y2 := l.pixel_xy(i, self.size - 1)
+		fmt.Fprintf(&b, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="%s"/>` + "\n", x1, y1, x2, y2, svg_colour(opts.LineColour))
+		x1, y1 = l.pixel_xy(0, i)
+		x2, y2 = l.pixel_xy(self.size - 1, i)
+		fmt.Fprintf(&b, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="%s"/>` + "\n", x1, y1, x2, y2, svg_colour(opts.LineColour))
+	}
+
+	for _, p := range star_points(self.size) {
+		x, y := l.pixel_xy(p.X, p.Y)
+		fmt.Fprintf(&b, `<circle cx="%d" cy="%d" r="%d" fill="%s"/>` + "\n", x, y, max_int(l.cell / 12, 2), svg_colour(opts.LineColour))
+	}
+
+	// Coordinates...
+
+	if opts.Coordinates {
+		near := l.margin + l.coords / 2
+		far := l.width - near
+		for i := 0; i < self.size; i++ {
+			x, y := l.pixel_xy(i, i)
+			svg_text(&b, x, near, l.cell * 2 / 5, opts.LineColour, l.column_label(i))
+			svg_text(&b, x, far, l.cell * 2 / 5, opts.LineColour, l.column_label(i))
+			svg_text(&b, near, y, l.cell * 2 / 5, opts.LineColour, l.row_label(i))
+			svg_text(&b, far, y, l.cell * 2 / 5, opts.LineColour, l.row_label(i))
+		}
+	}
+
+	// Stones, and whatever is on each point...
+
+	for x := 0; x < self.size; x++ {
+
+		for y := 0; y < self.size; y++ {
+
+			p := Point{x, y}
+			px, py := l.pixel_xy(x, y)
+			colour := self.board[x][y]
+			ink := opts.contrast(colour)
+
+			if colour != EMPTY {
+				fill := opts.BlackColour
+				if colour == WHITE {
+					fill = opts.WhiteColour
+				}
+				fmt.Fprintf(&b, `<circle cx="%d" cy="%d" r="%.1f" fill="%s" stroke="%s"/>` + "\n",
+					px, py, float64(l.cell) / 2 - 0.5, svg_colour(fill), svg_colour(opts.LineColour))
+			}
+
+			if n, ok := self.numbers[p]; ok {
+				text := fmt.Sprintf("%d", n)
+				svg_text(&b, px, py, number_font_size(l.cell, text), ink, text)
+			} else if text, ok := self.labels[p]; ok {
+				if colour == EMPTY {
+					fmt.Fprintf(&b, `<circle cx="%d" cy="%d" r="%d" fill="%s"/>` + "\n", px, py, l.cell * 2 / 5, svg_colour(opts.BoardColour))
+				}
+				svg_text(&b, px, py, number_font_size(l.cell, text), ink, text)
+			} else if key, ok := self.markup[p]; ok {
+				svg_markup(&b, key, px, py, l.cell, ink)
+			} else if p == self.last {
+				fmt.Fprintf(&b, `<circle cx="%d" cy="%d" r="%d" fill="%s"/>` + "\n", px, py, max_int(l.cell / 8, 2), svg_colour(ink))
+			}
+		}
+	}
+
+	// Arrows and lines...
+
+	for i, list := range [][]Arrow{self.arrows, self.lines} {
+		head := ""
+		if i == 0 {
+			head = ` marker-end="url(#arrowhead)"`
+		}
+		for _, a := range list {
+			x1, y1 := l.pixel_xy(a.From.X, a.From.Y)
+			x2, y2 := l.pixel_xy(a.To.X, a.To.Y)
+			fmt.Fprintf(&b, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="%s" stroke-width="%d"%s/>` + "\n",
+				x1, y1, x2, y2, svg_colour(opts.LineColour), max_int(l.cell / 12, 1), head)
+		}
+	}
+
+	// Caption...
+
+	for i, text := range self.caption {
+		fmt.Fprintf(&b, `<text x="%d" y="%d" font-family="sans-serif" font-size="%d" fill="%s">%s</text>` + "\n",
+			l.margin, l.width + (i + 1) * line_height, l.cell * 2 / 5, svg_colour(opts.LineColour), html.EscapeString(text))
+	}
+
+	b.WriteString("</svg>\n")
+
+	_, err := io.WriteString(outfile, b.String())
+	return err
+}
+
+
+func svg_markup(b *strings.Builder, key string, x, y, cell int, ink color.RGBA) {
+
+	c := float64(cell)
+	fx, fy := float64(x), float64(y)
+
+	style := fmt.Sprintf(`fill="none" stroke="%s" stroke-width="%d"`, svg_colour(ink), max_int(cell / 16, 1))
+
+	switch key {
+	case "CR":
+		fmt.Fprintf(b, `<circle cx="%d" cy="%d" r="%.1f" %s/>` + "\n", x, y, c * 0.25, style)
+	case "SQ":
+		fmt.Fprintf(b, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" %s/>` + "\n", fx - c * 0.2, fy - c * 0.2, c * 0.4, c * 0.4, style)
+	case "TR":
+		fmt.Fprintf(b, `<polygon points="%.1f,%.1f %.1f,%.1f %.1f,%.1f" %s/>` + "\n",
+			fx, fy - c * 0.3, fx - c * 0.26, fy + c * 0.15, fx + c * 0.26, fy + c * 0.15, style)
+	case "MA":
+		fmt.Fprintf(b, `<path d="M%.1f,%.1f L%.1f,%.1f M%.1f,%.1f L%.1f,%.1f" %s/>` + "\n",
+			fx - c * 0.2, fy - c * 0.2, fx + c * 0.2, fy + c * 0.2, fx - c * 0.2, fy + c * 0.2, fx + c * 0.2, fy - c * 0.2, style)
+	}
+}
+
+
+func svg_text(b *strings.Builder, x, y, font_size int, ink color.RGBA, text string) {
+	fmt.Fprintf(b, `<text x="%d" y="%d" font-family="sans-serif" font-size="%d" fill="%s" text-anchor="middle" dominant-baseline="central">%s</text>` + "\n",
+		x, y, font_size, svg_colour(ink), html.EscapeString(text))
+}
+
+
+func svg_colour(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+
+func number_font_size(cell int, text string) int {
+
+	// Shrink long numbers / labels so they fit on a stone.
+
+	switch len(text) {
+	case 1, 2:
+		return cell / 2
+	case 3:
+		return cell * 2 / 5
+	default:
+		return cell / 3
+	}
+}
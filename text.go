@@ -0,0 +1,136 @@
+package kikashi
+
+import (
+	"strings"
+)
+
+// -------------------------------------------------------------------------
+// Converting between stored (SGF, escaped) values and the values callers
+// see, according to the property's type in the PROPERTIES table:
+//
+//		Text:			soft line breaks (backslash-newline) are removed,
+//						other whitespace except newlines becomes a space.
+//		SimpleText:		as Text, but newlines also become spaces.
+//		Compose:		the two halves are split on the first unescaped ":"
+//						and decoded separately; ":" is escaped on writing.
+//
+// Any of "\r\n", "\n\r" and "\r" are treated as a newline. Unknown properties
+// just have their escapes removed, as before.
+
+
+func encode_value(key, value string) string {
+
+	if is_compose_type(PROPERTIES[key].Type) {
+		parts := strings.SplitN(value, ":", 2)
+		if len(parts) == 2 {
+			return escape_string(parts[0], true) + ":" + escape_string(parts[1], true)
+		}
+	}
+
+	if t := PROPERTIES[key].Type; t == TYPE_TEXT || t == TYPE_SIMPLETEXT {
+		value = normalise_newlines(value)
+	}
+
+	return escape_string(value, false)
+}
+
+
+func decode_value(key, raw string) string {
+
+	info, known := PROPERTIES[key]
+
+	if known == false {
+		return unescape_string(raw)
+	}
+
+	switch {
+
+	case info.Type == TYPE_TEXT:
+		return decode_text(raw, false)
+
+	case info.Type == TYPE_SIMPLETEXT:
+		return decode_text(raw, true)
+
+	case is_compose_type(info.Type):
+		first, second, ok := split_compose(raw)
+		if ok {
+			return decode_text(first, true) + ":" + decode_text(second, true)
+		}
+		return decode_text(raw, true)
+	}
+
+	return unescape_string(raw)
+}
+
+
+func decode_text(raw string, simple bool) string {
+
+	raw = normalise_newlines(raw)
+
+	var ret []byte
+
+	for n := 0; n < len(raw); n++ {
+
+		c := raw[n]
+
+		if c == '\\' && n + 1 < len(raw) {
+			n++
+			c = raw[n]
+			if c == '\n' {
+				continue						// Soft line break.
+			}
+		} else if c == '\\' {
+			continue							// Stray backslash at the very end.
+		} else if c == '\n' {
+			if simple {
+				c = ' '
+			}
+			ret = append(ret, c)
+			continue
+		}
+
+		if c == '\t' || c == '\v' || c == '\f' {
+			c = ' '
+		}
+
+		ret = append(ret, c)
+	}
+
+	return string(ret)
+}
+
+
+func split_compose(raw string) (string, string, bool) {
+
+	// Split a stored value on the first unescaped ":".
+
+	for n := 0; n < len(raw); n++ {
+		if raw[n] == '\\' {
+			n++
+			continue
+		}
+		if raw[n] == ':' {
+			return raw[:n], raw[n + 1:], true
+		}
+	}
+
+	return raw, "", false
+}
+
+
+func is_compose_type(t PropType) bool {
+	return t == TYPE_LABEL || t == TYPE_POINT_PAIR || t == TYPE_APP || t == TYPE_FIGURE
+}
+
+
+func normalise_newlines(s string) string {
+
+	if strings.IndexByte(s, '\r') == -1 {
+		return s
+	}
+
+	s = strings.Replace(s, "\r\n", "\n", -1)
+	s = strings.Replace(s, "\n\r", "\n", -1)
+	s = strings.Replace(s, "\r", "\n", -1)
+	return s
+}
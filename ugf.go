@@ -0,0 +1,371 @@
+package kikashi
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// -------------------------------------------------------------------------
+// Pandanet / IGS .ugf files. These are INI-like, with a [Header] section of
+// Key=value lines and a [Data] section of moves such as "QD,B1,0": the point
+// (column from the left, row from the bottom, both starting at "A"), then
+// colour and move number, then time used. Points off the board are passes.
+//
+// Comments are in the [Figure] section, as ".Text,N" (N being the move they
+// follow, or 0 for the start) then lines of text, then ".EndText". They go
+// in C[]. Other figure data is not imported.
+
+
+func LoadUGF(filename string) (*Node, error) {
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseUGF(data)
+}
+
+
+func ParseUGF(data []byte) (*Node, error) {
+
+	// If some moves were illegal, returns the tree anyway, with an IllegalMoves error.
+
+	header := make(map[string]string)
+	var moves []string
+	var figure []string
+
+	section := ""
+	in_text := false
+
+	for _, raw := range strings.Split(string(data), "\n") {
+
+		raw = strings.TrimRight(raw, "\r")
+		line := strings.TrimSpace(raw)
+
+		if in_text {							// Comment text could look like anything, even "[Data]".
+			figure = append(figure, raw)
+			in_text = line != ".EndText"
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = line
+			continue
+		}
+
+		switch section {
+		case "[Header]":
+			kv := strings.SplitN(line, "=", 2)
+			if len(kv) == 2 {
+				header[kv[0]] = strings.TrimSpace(kv[1])
+			}
+		case "[Data]":
+			if line != "" {
+				moves = append(moves, line)
+			}
+		case "[Figure]":
+			figure = append(figure, raw)
+			in_text = strings.HasPrefix(line, ".Text,")
+		}
+	}
+
+	if len(header) == 0 {
+		return nil, fmt.Errorf("ParseUGF(): no [Header] section")
+	}
+
+	size := 19
+	if s, ok := header["Size"]; ok {
+		v, err := strconv.Atoi(s)
+		if err != nil || v < 1 || v > 25 {
+			return nil, fmt.Errorf("ParseUGF(): bad board size %q", s)
+		}
+		size = v
+	}
+
+	hdcp := strings.Split(header["Hdcp"], ",")
+	handicap, _ := strconv.Atoi(hdcp[0])
+
+	root := new_import_root(size, handicap)
+
+	if len(hdcp) > 1 {
+		if komi, err := strconv.ParseFloat(hdcp[1], 64); err == nil {
+			root.SetValue("KM", FormatReal(komi))
+		}
+	}
+
+	if s := header["Title"]; s != "" {
+		root.SetValue("GN", s)
+	}
+
+	if s := header["Place"]; s != "" {
+		root.SetValue("PC", s)
+	}
+
+	for _, item := range [][3]string{{"PlayerB", "PB", "BR"}, {"PlayerW", "PW", "WR"}} {
+		fields := strings.Split(header[item[0]], ",")
+		if fields[0] != "" {
+			root.SetValue(item[1], fields[0])
+		}
+		if len(fields) > 1 && fields[1] != "" {
+			root.SetValue(item[2], fields[1])
+		}
+	}
+
+	if s := header["Date"]; s != "" {
+		if date, ok := loose_date(strings.Split(s, ",")[0]); ok {
+			root.SetValue("DT", date.String())
+		}
+	}
+
+	if result := ugf_result(header["Winner"]); result != "" {
+		root.SetValue("RE", result)
+	}
+
+	var illegal IllegalMoves
+	node := root
+
+	var nodes []*Node							// The node after each move, by move number.
+
+	for i, line := range moves {
+
+		nodes = append(nodes, node)
+
+		fields := strings.Split(line, ",")
+
+		if len(fields) < 2 || len(fields[0]) != 2 || len(fields[1]) < 1 {
+			illegal = append(illegal, fmt.Errorf("unreadable move: %s", line))
+			continue
+		}
+
+		var colour Colour
+
+		switch fields[1][0] {
+		case 'B': colour = BLACK
+		case 'W': colour = WHITE
+		default:
+			illegal = append(illegal, fmt.Errorf("unreadable move: %s", line))
+			continue
+		}
+
+		x := int(fields[0][0]) - 'A'
+		y := size - 1 - (int(fields[0][1]) - 'A')
+		pass := x < 0 || x >= size || y < 0 || y >= size
+
+		node = play_imported_move(node, colour, x, y, pass, i + 1, &illegal)
+	}
+
+	nodes = append(nodes, node)
+	ugf_comments(nodes, figure)
+
+	if len(illegal) > 0 {
+		return root, illegal
+	}
+
+	return root, nil
+}
+
+
+func ugf_comments(nodes []*Node, figure []string) {
+
+	// Put each ".Text,N" block of the [Figure] section in the C[] of the node
+	// after move N. Blocks for the same node are separated by a blank line.
+
+	var text []string
+	var node *Node
+
+	for _, raw := range figure {
+
+		line := strings.TrimSpace(raw)
+
+		if node != nil {
+			if line == ".EndText" {
+				add_comment(node, strings.Join(text, "\n"))
+				node = nil
+			} else {
+				text = append(text, raw)
+			}
+			continue
+		}
+
+		if strings.HasPrefix(line, ".Text,") {
+			n, err := strconv.Atoi(strings.TrimSpace(strings.Split(line, ",")[1]))
+			if err == nil && n >= 0 {
+				if n >= len(nodes) {
+					n = len(nodes) - 1
+				}
+				node = nodes[n]
+				text = nil
+			}
+		}
+	}
+
+	if node != nil {							// Unterminated; keep it anyway.
+		add_comment(node, strings.Join(text, "\n"))
+	}
+}
+
+
+func add_comment(node *Node, text string) {
+
+	text = strings.Trim(text, "\n")
+	if text == "" {
+		return
+	}
+
+	if existing, ok := node.GetValue("C"); ok && existing != "" {
+		text = existing + "\n\n" + text
+	}
+
+	node.SetValue("C", text)
+}
+
+
+func ugf_result(s string) string {
+
+	// e.g. "B,3.5", "W,C" (resignation, "chuuoshi"), "W,T" (time).
+
+	fields := strings.Split(s, ",")
+
+	var ret string
+
+	switch fields[0] {
+	case "B": ret = "B+"
+	case "W": ret = "W+"
+	case "D": return "0"
+	default: return ""
+	}
+
+	if len(fields) > 1 {
+		switch strings.ToUpper(fields[1]) {
+		case "C", "R":
+			ret += "R"
+		case "T":
+			ret += "T"
+		default:
+			if v, err := strconv.ParseFloat(fields[1], 64); err == nil && v > 0 {
+				ret += FormatReal(v)
+			}
+		}
+	}
+
+	return ret
+}
+
+
+func (self *Node) SaveUGF(filename string) error {
+
+	// Saves the main line (following Children[0]) from the root, with its
+	// comments; UGF as written here holds no variations.
+
+	outfile, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer outfile.Close()
+
+	w := bufio.NewWriter(outfile)
+	defer w.Flush()
+
+	return self.GetRoot().WriteUGF(w)
+}
+
+
+func (self *Node) WriteUGF(outfile io.Writer) error {
+
+	root := self.GetRoot()
+	info := root.GetGameInfo()
+	sz := root.Size()
+
+	if sz > 25 {
+		return fmt.Errorf("WriteUGF(): board too large")
+	}
+
+	title, _ := root.GetValue("GN")
+
+	lines := []string{
+		"[Header]",
+		"Lang=EN",
+		"Title=" + title,
+		fmt.Sprintf("Size=%d", sz),
+		fmt.Sprintf("Hdcp=%d,%s", info.Handicap, FormatReal(info.Komi)),
+		"PlayerB=" + ugf_field(info.PlayerBlack) + "," + ugf_field(info.RankBlack),
+		"PlayerW=" + ugf_field(info.PlayerWhite) + "," + ugf_field(info.RankWhite),
+		"Place=" + ugf_field(info.Place),
+	}
+
+	if len(info.Dates) > 0 {
+		lines = append(lines, "Date=" + strings.Replace(info.Dates[0].String(), "-", "/", -1))
+	}
+
+	r := info.Result
+
+	if r.Draw {
+		lines = append(lines, "Winner=D")
+	} else if r.Winner == BLACK || r.Winner == WHITE {
+		how := ""
+		if r.Resign {
+			how = "C"
+		} else if r.Time {
+			how = "T"
+		} else if r.Margin != 0 {
+			how = FormatReal(r.Margin)
+		}
+		lines = append(lines, "Winner=" + COLMAP[r.Winner] + "," + how)
+	}
+
+	lines = append(lines, "[Data]")
+
+	var figure []string
+	n := 0
+
+	it := root.MainLine()
+	for node := it.Next(); node != nil; node = it.Next() {
+
+		mv := node.MoveInfo()
+
+		if mv.OK {
+
+			n++
+
+			point := "ZZ"					// Off any board up to 25x25, i.e. a pass.
+			if mv.Pass == false {
+				point = string([]byte{byte('A' + mv.X), byte('A' + (sz - 1 - mv.Y))})
+			}
+
+			lines = append(lines, fmt.Sprintf("%s,%s%d,0", point, COLMAP[mv.Colour], n))
+		}
+
+		// Comments on nodes without moves go with the last move before them.
+
+		if comment, ok := node.GetValue("C"); ok && comment != "" {
+			figure = append(figure, fmt.Sprintf(".Text,%d", n))
+			figure = append(figure, strings.Split(strings.Replace(comment, "\r\n", "\n", -1), "\n")...)
+			figure = append(figure, ".EndText")
+		}
+	}
+
+	if len(figure) > 0 {
+		lines = append(lines, "[Figure]")
+		lines = append(lines, figure...)
+	}
+
+	for _, line := range lines {
+		_, err := fmt.Fprintf(outfile, "%s\r\n", line)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+
+func ugf_field(s string) string {
+	return strings.Replace(s, ",", " ", -1)
+}
@@ -0,0 +1,93 @@
+package kikashi
+
+import (
+	"bytes"
+	"testing"
+)
+
+// -------------------------------------------------------------------------
+
+const UGF_SAMPLE = "[Header]\r\n" +
+	"Lang=JP\r\n" +
+	"Title=Test game\r\n" +
+	"Size=9\r\n" +
+	"Hdcp=0,6.5\r\n" +
+	"PlayerB=Alice,3d\r\n" +
+	"PlayerW=Bob,2d\r\n" +
+	"Winner=W,C\r\n" +
+	"[Data]\r\n" +
+	"CG,B1,0\r\n" +
+	"GC,W2,0\r\n" +
+	"EE,B3,0\r\n" +
+	"[Figure]\r\n" +
+	".Fig,1,1,0,0,0,0\r\n" +
+	".Text,0\r\n" +
+	"A friendly game.\r\n" +
+	".EndText\r\n" +
+	".Text,2\r\n" +
+	"White answers.\r\n" +
+	"  Indented, and:\r\n" +
+	"[Data]\r\n" +
+	".EndText\r\n" +
+	".Text,3\r\n" +
+	"Tengen.\r\n" +
+	".EndText\r\n" +
+	".EndFig\r\n"
+
+
+func TestUGFRoundTrip(t *testing.T) {
+
+	root, err := ParseUGF([]byte(UGF_SAMPLE))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(root *Node, when string) {
+
+		want := []string{"A friendly game.", "", "White answers.\n  Indented, and:\n[Data]", "Tengen."}
+
+		node := root
+
+		for i, comment := range want {
+
+			if node == nil {
+				t.Fatalf("%s: only %d nodes", when, i)
+			}
+
+			got, _ := node.GetValue("C")
+			if got != comment {
+				t.Errorf("%s: node %d has comment %q, want %q", when, i, got, comment)
+			}
+
+			if len(node.Children) > 0 {
+				node = node.Children[0]
+			} else {
+				node = nil
+			}
+		}
+
+		if node != nil {
+			t.Errorf("%s: too many nodes", when)
+		}
+
+		if mv := root.GetEnd().MoveInfo(); mv.Colour != BLACK || mv.X != 4 || mv.Y != 4 {
+			t.Errorf("%s: last move is %s", when, mv.String())
+		}
+	}
+
+	check(root, "read")
+
+	var buf bytes.Buffer
+
+	err = root.WriteUGF(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	again, err := ParseUGF(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	check(again, "written and read back")
+}
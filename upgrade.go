@@ -0,0 +1,189 @@
+package kikashi
+
+import (
+	"fmt"
+	"strings"
+)
+
+// -------------------------------------------------------------------------
+// Upgrading FF[1] - FF[3] files to FF[4] semantics. Intended for trees read
+// with LoadVerbatim(), though trees from Load() are fine too (their keys
+// have already lost any lowercase letters).
+
+var OBSOLETE_PROPERTIES = []string{
+	"BS", "CH", "EL", "EX", "ID", "LT", "OM", "OP", "OV", "RG", "SC", "SE", "SI", "TC", "WS",
+}
+
+
+func (self *Node) Upgrade() []Diagnostic {
+
+	// Convert the whole tree in place, returning a list of what was changed
+	// (or left alone but noteworthy). Boards are rebuilt afterwards.
+
+	var report []Diagnostic
+	var path []int
+
+	root := self.GetRoot()
+
+	root.WalkDepthFirst(func(node *Node, depth int) WalkAction {
+
+		if depth > 0 {
+			path = append(path[:depth - 1], node.SiblingIndex())
+		}
+
+		note := func(key, format string, args ...interface{}) {
+			report = append(report, Diagnostic{
+				Path: append([]int(nil), path...),
+				Key: key,
+				Message: fmt.Sprintf(format, args...),
+			})
+		}
+
+		// Long keys like AddBlack[] become AB[]...
+
+		for _, key := range node.ordered_keys() {
+
+			short := strings.Map(func(r rune) rune {
+				if r >= 'A' && r <= 'Z' {
+					return r
+				}
+				return -1
+			}, key)
+
+			if short != key && short != "" {
+				node.rename_key(key, short)
+				note(short, "key %s renamed to %s", key, short)
+			}
+		}
+
+		// Properties removed in FF[4], where there's an equivalent...
+
+		if len(node.Props["L"]) > 0 {
+			points := points_from_list(node.Props["L"], root.Size())
+			node.delete_key("L")
+			for i, p := range points {
+				node.append_raw_value("LB", p.SGFString() + ":" + label_letters(i))
+			}
+			note("LB", "L converted to LB (%d labels)", len(points))
+		}
+
+		if len(node.Props["M"]) > 0 {
+			node.rename_key("M", "MA")
+			note("MA", "M converted to MA")
+		}
+
+		for _, key := range OBSOLETE_PROPERTIES {
+			if len(node.Props[key]) > 0 {
+				note(key, "obsolete property, left unchanged")
+			}
+		}
+
+		// Passes written as "tt"...
+
+		if root.Size() <= 19 {
+			for _, key := range []string{"B", "W"} {
+				for i, v := range node.Props[key] {
+					if v == "tt" {
+						node.Props[key][i] = ""
+						note(key, "pass tt converted to empty value")
+					}
+				}
+			}
+		}
+
+		// Times left that aren't plain reals, e.g. BL[300s]...
+
+		for _, key := range []string{"BL", "WL"} {
+			for i, v := range node.Props[key] {
+				if real_regexp.MatchString(v) {
+					continue
+				}
+				if f, ok := leading_real(v); ok {
+					node.Props[key][i] = f
+					note(key, "value %q converted to %q", v, f)
+				} else {
+					note(key, "value %q is not a real number, left unchanged", v)
+				}
+			}
+		}
+
+		return WALK_CONTINUE
+
+	}, nil)
+
+	if ff, _ := root.GetValue("FF"); ff != "4" {
+		if ff == "" {
+			note_root(&report, "FF", "FF set to 4")
+		} else {
+			note_root(&report, "FF", fmt.Sprintf("FF changed from %s to 4", ff))
+		}
+		root.SetValue("FF", "4")
+	}
+
+	if _, ok := root.GetValue("GM"); ok == false {
+		root.SetValue("GM", "1")
+		note_root(&report, "GM", "GM set to 1")
+	}
+
+	root.rebuild_boards()
+	return report
+}
+
+
+func (self *Node) rename_key(old_key, new_key string) {
+
+	// Move all values from old_key to new_key, which takes old_key's place
+	// in the key order unless it already exists.
+
+	values := self.Props[old_key]
+
+	if _, exists := self.Props[new_key]; exists == false {
+		for i, key := range self.key_order {
+			if key == old_key {
+				self.key_order[i] = new_key
+			}
+		}
+	}
+
+	self.delete_key(old_key)
+
+	for _, v := range values {
+		self.append_raw_value(new_key, v)
+	}
+}
+
+
+func note_root(report *[]Diagnostic, key, message string) {
+	*report = append(*report, Diagnostic{Path: []int{}, Key: key, Message: message})
+}
+
+
+func label_letters(i int) string {
+
+	// "a", "b", ... "z", "aa", "ab" ... as FF[3] L[] used lowercase letters.
+
+	s := ""
+	for {
+		s = string(rune('a' + i % 26)) + s
+		i = i / 26 - 1
+		if i < 0 {
+			return s
+		}
+	}
+}
+
+
+func leading_real(s string) (string, bool) {
+
+	// The longest prefix that is a valid real, e.g. "300.5s" -> "300.5".
+
+	s = strings.TrimSpace(s)
+
+	for n := len(s); n > 0; n-- {
+		if real_regexp.MatchString(s[:n]) {
+			return s[:n], true
+		}
+	}
+
+	return "", false
+}
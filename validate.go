@@ -0,0 +1,390 @@
+package kikashi
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// -------------------------------------------------------------------------
+// The FF[4] property table, and a validator built on it. Unknown (e.g.
+// private) properties are allowed and not checked.
+
+type PropType int
+
+const (
+	TYPE_NONE = PropType(iota)			// Empty value only, e.g. KO[]
+	TYPE_NUMBER
+	TYPE_REAL
+	TYPE_DOUBLE							// "1" or "2"
+	TYPE_COLOUR							// "B" or "W"
+	TYPE_SIMPLETEXT
+	TYPE_TEXT
+	TYPE_POINT
+	TYPE_MOVE							// Point, or pass
+	TYPE_POINT_LIST						// List of point, compression allowed
+	TYPE_POINT_ELIST					// Same but may be a single empty value
+	TYPE_LABEL							// point:simpletext
+	TYPE_POINT_PAIR						// point:point (AR, LN)
+	TYPE_SIZE							// number, or number:number
+	TYPE_APP							// simpletext:simpletext (AP)
+	TYPE_FIGURE							// none, or number:simpletext (FG)
+)
+
+type PropScope int
+
+const (
+	SCOPE_ANY = PropScope(iota)
+	SCOPE_ROOT
+	SCOPE_GAME_INFO
+	SCOPE_MOVE
+	SCOPE_SETUP
+)
+
+type PropInfo struct {
+	Type			PropType
+	Scope			PropScope
+	List			bool			// More than one value allowed.
+}
+
+var PROPERTIES = map[string]PropInfo{
+
+	// Move
+
+	"B":  {TYPE_MOVE, SCOPE_MOVE, false},
+	"W":  {TYPE_MOVE, SCOPE_MOVE, false},
+	"KO": {TYPE_NONE, SCOPE_MOVE, false},
+	"MN": {TYPE_NUMBER, SCOPE_MOVE, false},
+
+	// Setup
+
+	"AB": {TYPE_POINT_LIST, SCOPE_SETUP, true},
+	"AW": {TYPE_POINT_LIST, SCOPE_SETUP, true},
+	"AE": {TYPE_POINT_LIST, SCOPE_SETUP, true},
+	"PL": {TYPE_COLOUR, SCOPE_SETUP, false},
+
+	// Node annotation
+
+	"C":  {TYPE_TEXT, SCOPE_ANY, false},
+	"DM": {TYPE_DOUBLE, SCOPE_ANY, false},
+	"GB": {TYPE_DOUBLE, SCOPE_ANY, false},
+	"GW": {TYPE_DOUBLE, SCOPE_ANY, false},
+	"HO": {TYPE_DOUBLE, SCOPE_ANY, false},
+	"N":  {TYPE_SIMPLETEXT, SCOPE_ANY, false},
+	"UC": {TYPE_DOUBLE, SCOPE_ANY, false},
+	"V":  {TYPE_REAL, SCOPE_ANY, false},
+
+	// Move annotation
+
+	"BM": {TYPE_DOUBLE, SCOPE_MOVE, false},
+	"DO": {TYPE_NONE, SCOPE_MOVE, false},
+	"IT": {TYPE_NONE, SCOPE_MOVE, false},
+	"TE": {TYPE_DOUBLE, SCOPE_MOVE, false},
+
+	// Markup
+
+	"AR": {TYPE_POINT_PAIR, SCOPE_ANY, true},
+	"CR": {TYPE_POINT_LIST, SCOPE_ANY, true},
+	"DD": {TYPE_POINT_ELIST, SCOPE_ANY, true},
+	"LB": {TYPE_LABEL, SCOPE_ANY, true},
+	"LN": {TYPE_POINT_PAIR, SCOPE_ANY, true},
+	"MA": {TYPE_POINT_LIST, SCOPE_ANY, true},
+	"SL": {TYPE_POINT_LIST, SCOPE_ANY, true},
+	"SQ": {TYPE_POINT_LIST, SCOPE_ANY, true},
+	"TR": {TYPE_POINT_LIST, SCOPE_ANY, true},
+
+	// Root
+
+	"AP": {TYPE_APP, SCOPE_ROOT, false},
+	"CA": {TYPE_SIMPLETEXT, SCOPE_ROOT, false},
+	"FF": {TYPE_NUMBER, SCOPE_ROOT, false},
+	"GM": {TYPE_NUMBER, SCOPE_ROOT, false},
+	"ST": {TYPE_NUMBER, SCOPE_ROOT, false},
+	"SZ": {TYPE_SIZE, SCOPE_ROOT, false},
+
+	// Game info
+
+	"AN": {TYPE_SIMPLETEXT, SCOPE_GAME_INFO, false},
+	"BR": {TYPE_SIMPLETEXT, SCOPE_GAME_INFO, false},
+	"BT": {TYPE_SIMPLETEXT, SCOPE_GAME_INFO, false},
+	"CP": {TYPE_SIMPLETEXT, SCOPE_GAME_INFO, false},
+	"DT": {TYPE_SIMPLETEXT, SCOPE_GAME_INFO, false},
+	"EV": {TYPE_SIMPLETEXT, SCOPE_GAME_INFO, false},
+	"GC": {TYPE_TEXT, SCOPE_GAME_INFO, false},
+	"GN": {TYPE_SIMPLETEXT, SCOPE_GAME_INFO, false},
+	"HA": {TYPE_NUMBER, SCOPE_GAME_INFO, false},
+	"KM": {TYPE_REAL, SCOPE_GAME_INFO, false},
+	"ON": {TYPE_SIMPLETEXT, SCOPE_GAME_INFO, false},
+	"OT": {TYPE_SIMPLETEXT, SCOPE_GAME_INFO, false},
+	"PB": {TYPE_SIMPLETEXT, SCOPE_GAME_INFO, false},
+	"PC": {TYPE_SIMPLETEXT, SCOPE_GAME_INFO, false},
+	"PW": {TYPE_SIMPLETEXT, SCOPE_GAME_INFO, false},
+	"RE": {TYPE_SIMPLETEXT, SCOPE_GAME_INFO, false},
+	"RO": {TYPE_SIMPLETEXT, SCOPE_GAME_INFO, false},
+	"RU": {TYPE_SIMPLETEXT, SCOPE_GAME_INFO, false},
+	"SO": {TYPE_SIMPLETEXT, SCOPE_GAME_INFO, false},
+	"TM": {TYPE_REAL, SCOPE_GAME_INFO, false},
+	"US": {TYPE_SIMPLETEXT, SCOPE_GAME_INFO, false},
+	"WR": {TYPE_SIMPLETEXT, SCOPE_GAME_INFO, false},
+	"WT": {TYPE_SIMPLETEXT, SCOPE_GAME_INFO, false},
+
+	// Timing
+
+	"BL": {TYPE_REAL, SCOPE_MOVE, false},
+	"OB": {TYPE_NUMBER, SCOPE_MOVE, false},
+	"OW": {TYPE_NUMBER, SCOPE_MOVE, false},
+	"WL": {TYPE_REAL, SCOPE_MOVE, false},
+
+	// Miscellaneous, and Go specific
+
+	"FG": {TYPE_FIGURE, SCOPE_ANY, false},
+	"PM": {TYPE_NUMBER, SCOPE_ANY, false},
+	"VW": {TYPE_POINT_ELIST, SCOPE_ANY, true},
+	"TB": {TYPE_POINT_ELIST, SCOPE_ANY, true},
+	"TW": {TYPE_POINT_ELIST, SCOPE_ANY, true},
+}
+
+var number_regexp = regexp.MustCompile(`^[+-]?[0-9]+$`)
+var real_regexp = regexp.MustCompile(`^[+-]?[0-9]+(\.[0-9]+)?$`)
+
+// -------------------------------------------------------------------------
+
+type Diagnostic struct {
+	Path			[]int
+	Key				string			// Empty if the problem isn't with one property.
+	Message			string
+}
+
+
+func (self Diagnostic) String() string {
+	if self.Key == "" {
+		return fmt.Sprintf("%s: %s", PathString(self.Path), self.Message)
+	}
+	return fmt.Sprintf("%s %s: %s", PathString(self.Path), self.Key, self.Message)
+}
+
+
+func (self *Node) Validate() []Diagnostic {
+
+	// Check the whole tree, from the root, against the FF[4] spec.
+
+	var diagnostics []Diagnostic
+	var path []int
+	var game_info_above []bool				// Indexed by depth: game info seen at or above this depth?
+
+	root := self.GetRoot()
+	sz := root.Size()
+
+	root.WalkDepthFirst(func(node *Node, depth int) WalkAction {
+
+		if depth > 0 {
+			path = append(path[:depth - 1], node.SiblingIndex())
+		}
+
+		report := func(key, format string, args ...interface{}) {
+			diagnostics = append(diagnostics, Diagnostic{
+				Path: append([]int(nil), path...),
+				Key: key,
+				Message: fmt.Sprintf(format, args...),
+			})
+		}
+
+		var has_move, has_setup, has_game_info bool
+
+		for _, key := range sorted_keys(node.Props) {
+
+			info, known := PROPERTIES[key]
+			if known == false {
+				continue
+			}
+
+			values := node.AllValues(key)
+
+			if len(values) > 1 && info.List == false {
+				report(key, "has %d values, expected 1", len(values))
+			}
+
+			for _, value := range values {
+				if msg := check_value(info.Type, value, sz); msg != "" {
+					report(key, "%s: %q", msg, value)
+				}
+			}
+
+			switch info.Scope {
+			case SCOPE_ROOT:
+				if depth > 0 {
+					report(key, "root property in non-root node")
+				}
+			case SCOPE_GAME_INFO:
+				has_game_info = true
+			case SCOPE_MOVE:
+				has_move = true
+			case SCOPE_SETUP:
+				has_setup = true
+			}
+		}
+
+		if has_move && has_setup {
+			report("", "move and setup properties in the same node")
+		}
+
+		if len(node.Props["B"]) > 0 && len(node.Props["W"]) > 0 {
+			report("", "both B and W in the same node")
+		}
+
+		if len(node.Props["B"]) == 0 && len(node.Props["W"]) == 0 {
+			for _, key := range []string{"KO", "BM", "DO", "IT", "TE"} {
+				if len(node.Props[key]) > 0 {
+					report(key, "move annotation without a move")
+				}
+			}
+		}
+
+		if count_present(node, "BM", "DO", "IT", "TE") > 1 {
+			report("", "more than one of BM, DO, IT, TE")
+		}
+
+		if count_present(node, "DM", "GB", "GW", "UC") > 1 {
+			report("", "more than one of DM, GB, GW, UC")
+		}
+
+		setup_seen := make(map[Point]bool)
+		for _, key := range []string{"AB", "AW", "AE"} {
+			for _, p := range points_from_list(node.AllValues(key), sz) {
+				if setup_seen[p] {
+					report(key, "point %s set more than once", p.SGFString())
+				}
+				setup_seen[p] = true
+			}
+		}
+
+		above := depth > 0 && game_info_above[depth - 1]
+		if has_game_info && above {
+			report("", "game info properties appear more than once in this line")
+		}
+		game_info_above = append(game_info_above[:depth], above || has_game_info)
+
+		return WALK_CONTINUE
+
+	}, nil)
+
+	return diagnostics
+}
+
+
+func check_value(t PropType, value string, size int) string {
+
+	// Returns a description of the problem, or "" if the value is fine.
+
+	switch t {
+
+	case TYPE_NONE:
+		if value != "" {
+			return "expected empty value"
+		}
+
+	case TYPE_NUMBER:
+		if number_regexp.MatchString(value) == false {
+			return "not a number"
+		}
+
+	case TYPE_REAL:
+		if real_regexp.MatchString(value) == false {
+			return "not a real number"
+		}
+
+	case TYPE_DOUBLE:
+		if value != "1" && value != "2" {
+			return "expected 1 or 2"
+		}
+
+	case TYPE_COLOUR:
+		if value != "B" && value != "W" {
+			return "expected B or W"
+		}
+
+	case TYPE_POINT:
+		if valid_point(value, size) == false {
+			return "invalid point"
+		}
+
+	case TYPE_MOVE:
+		if value != "" && (value != "tt" || size > 19) && valid_point(value, size) == false {
+			return "invalid move"
+		}
+
+	case TYPE_POINT_LIST, TYPE_POINT_ELIST:
+		if value == "" && t == TYPE_POINT_ELIST {
+			return ""
+		}
+		parts := strings.SplitN(value, ":", 2)
+		for _, part := range parts {
+			if valid_point(part, size) == false {
+				return "invalid point"
+			}
+		}
+
+	case TYPE_LABEL:
+		parts := strings.SplitN(value, ":", 2)
+		if len(parts) != 2 || valid_point(parts[0], size) == false {
+			return "expected point:text"
+		}
+
+	case TYPE_POINT_PAIR:
+		parts := strings.SplitN(value, ":", 2)
+		if len(parts) != 2 || valid_point(parts[0], size) == false || valid_point(parts[1], size) == false {
+			return "expected point:point"
+		}
+		if parts[0] == parts[1] {
+			return "start and end are the same point"
+		}
+
+	case TYPE_SIZE:
+		for _, part := range strings.SplitN(value, ":", 2) {
+			n, err := strconv.Atoi(part)
+			if err != nil || n < 1 || n > 52 {
+				return "invalid board size"
+			}
+		}
+
+	case TYPE_APP:
+		if len(strings.SplitN(value, ":", 2)) != 2 {
+			return "expected name:version"
+		}
+
+	case TYPE_FIGURE:
+		if value != "" {
+			parts := strings.SplitN(value, ":", 2)
+			if len(parts) != 2 || number_regexp.MatchString(parts[0]) == false {
+				return "expected empty value or number:text"
+			}
+		}
+	}
+
+	return ""
+}
+
+
+func valid_point(s string, size int) bool {
+
+	if len(s) != 2 {
+		return false
+	}
+
+	x := strings.IndexByte(ALPHA, s[0])
+	y := strings.IndexByte(ALPHA, s[1])
+
+	return x >= 0 && x < size && y >= 0 && y < size
+}
+
+
+func count_present(node *Node, keys ...string) int {
+	n := 0
+	for _, key := range keys {
+		if len(node.Props[key]) > 0 {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,147 @@
+package kikashi
+
+// -------------------------------------------------------------------------
+// Tree walking. These are iterative rather than recursive, so that very deep
+// trees are no problem.
+
+type WalkAction int
+
+const (
+	WALK_CONTINUE = WalkAction(iota)
+	WALK_SKIP							// Don't descend into this node's children. (Pre-order only.)
+	WALK_STOP							// End the walk now.
+)
+
+// The depth is relative to the node the walk started from.
+
+type WalkFunc func(node *Node, depth int) WalkAction
+
+
+func (self *Node) WalkDepthFirst(pre, post WalkFunc) bool {
+
+	// Visit this node and everything below it, children in order. Either
+	// callback may be nil. The post-order callback of a skipped node is still
+	// called. Returns false if the walk was stopped early.
+
+	type frame struct {
+		node		*Node
+		depth		int
+		next		int				// Index of the next child to visit.
+	}
+
+	if pre != nil {
+		switch pre(self, 0) {
+		case WALK_STOP:
+			return false
+		case WALK_SKIP:
+			if post != nil && post(self, 0) == WALK_STOP {
+				return false
+			}
+			return true
+		}
+	}
+
+	stack := []*frame{&frame{self, 0, 0}}
+
+	for len(stack) > 0 {
+
+		f := stack[len(stack) - 1]
+
+		if f.next >= len(f.node.Children) {
+			stack = stack[:len(stack) - 1]
+			if post != nil && post(f.node, f.depth) == WALK_STOP {
+				return false
+			}
+			continue
+		}
+
+		child := f.node.Children[f.next]
+		f.next++
+
+		if pre != nil {
+			switch pre(child, f.depth + 1) {
+			case WALK_STOP:
+				return false
+			case WALK_SKIP:
+				if post != nil && post(child, f.depth + 1) == WALK_STOP {
+					return false
+				}
+				continue
+			}
+		}
+
+		stack = append(stack, &frame{child, f.depth + 1, 0})
+	}
+
+	return true
+}
+
+
+func (self *Node) WalkBreadthFirst(fn WalkFunc) bool {
+
+	// Visit this node and everything below it, level by level.
+	// Returns false if the walk was stopped early.
+
+	type item struct {
+		node		*Node
+		depth		int
+	}
+
+	queue := []item{{self, 0}}
+
+	for len(queue) > 0 {
+
+		it := queue[0]
+		queue = queue[1:]
+
+		switch fn(it.node, it.depth) {
+		case WALK_STOP:
+			return false
+		case WALK_SKIP:
+			continue
+		}
+
+		for _, child := range it.node.Children {
+			queue = append(queue, item{child, it.depth + 1})
+		}
+	}
+
+	return true
+}
+
+// -------------------------------------------------------------------------
+
+type LineIterator struct {
+	next			*Node
+}
+
+
+func (self *Node) MainLine() *LineIterator {
+
+	// Iterates from this node (inclusive) down the main line, i.e. Children[0].
+	//
+	//		it := node.MainLine()
+	//		for n := it.Next(); n != nil; n = it.Next() { ... }
+
+	return &LineIterator{next: self}
+}
+
+
+func (self *LineIterator) Next() *Node {
+
+	// Returns nil when the line is finished.
+
+	node := self.next
+
+	if node == nil {
+		return nil
+	}
+
+	if len(node.Children) > 0 {
+		self.next = node.Children[0]
+	} else {
+		self.next = nil
+	}
+
+	return node
+}